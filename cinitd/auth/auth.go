@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Roles of the API tokens. Every role may also run the actions of the roles before it
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var (
+	// ErrUnauthenticated is returned for requests without a token or with an unknown one
+	ErrUnauthenticated = errors.New("missing or unknown token")
+	// ErrForbidden is returned for requests whose token has a role that can not run the action
+	ErrForbidden = errors.New("token role can not run this action")
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// actionRoles holds the least role that may run an action. Actions that are not listed
+// need the admin role
+var actionRoles = map[string]string{
+	"status":   RoleViewer,
+	"list":     RoleViewer,
+	"logs":     RoleViewer,
+	"events":   RoleViewer,
+	"metrics":  RoleViewer,
+	"start":    RoleOperator,
+	"stop":     RoleOperator,
+	"restart":  RoleOperator,
+	"reload":   RoleOperator,
+	"signal":   RoleOperator,
+	"scale":    RoleOperator,
+	"register": RoleAdmin,
+	"delete":   RoleAdmin,
+}
+
+// Roles returns the supported roles
+func Roles() []string {
+	return []string{RoleViewer, RoleOperator, RoleAdmin}
+}
+
+// ActionRole returns the least role that may run action
+func ActionRole(action string) string {
+	if role, ok := actionRoles[action]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// Token is an API token. Name identifies the token in the logs of cinitd
+type Token struct {
+	Name  string `yaml:"name"`
+	Role  string `yaml:"role"`
+	Token string `yaml:"token"`
+}
+
+type tokenFile struct {
+	Tokens []Token `yaml:"tokens"`
+}
+
+// ReadFile reads the tokens of a YAML file with a list of tokens under the tokens key
+func ReadFile(path string) ([]Token, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f tokenFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return f.Tokens, nil
+}
+
+// ParseEnv reads tokens from CINIT_TOKEN_<NAME> variables, keyed by their full name. Every
+// value is <role>:<token> and the token is named after the lowercase <NAME>
+func ParseEnv(env map[string]string) ([]Token, error) {
+	names := make([]string, 0, len(env))
+	for k := range env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	tokens := make([]Token, 0, len(names))
+	for _, name := range names {
+		pair := strings.SplitN(env[name], ":", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("%s: value is not <role>:<token>", name)
+		}
+		tokens = append(tokens, Token{
+			Name:  strings.ToLower(strings.TrimPrefix(name, "CINIT_TOKEN_")),
+			Role:  pair[0],
+			Token: pair[1],
+		})
+	}
+	return tokens, nil
+}
+
+// Authenticator checks the bearer tokens of API requests. An Authenticator without tokens,
+// as well as a nil one, allows every request
+type Authenticator struct {
+	tokens map[[sha256.Size]byte]Token
+}
+
+// NewAuthenticator validates tokens and returns an Authenticator for them
+func NewAuthenticator(tokens []Token) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens: make(map[[sha256.Size]byte]Token),
+	}
+
+	for _, t := range tokens {
+		if t.Name == "" {
+			return nil, fmt.Errorf("token name can not be empty")
+		}
+		if t.Token == "" {
+			return nil, fmt.Errorf("token %s: token can not be empty", t.Name)
+		}
+		if _, ok := roleLevels[t.Role]; !ok {
+			return nil, fmt.Errorf("token %s: role %s not supported", t.Name, t.Role)
+		}
+
+		// Tokens are looked up by their hash, so that the lookup does not depend on how
+		// much of a token a client guessed
+		sum := sha256.Sum256([]byte(t.Token))
+		if j, ok := a.tokens[sum]; ok {
+			return nil, fmt.Errorf("token %s: same token as %s", t.Name, j.Name)
+		}
+		a.tokens[sum] = t
+	}
+
+	return a, nil
+}
+
+// Enabled returns true if requests need a token
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.tokens) > 0
+}
+
+// Authorize returns the Token of token if its role may run action. The name of the
+// returned Token is set, if token is known, even when an error is returned
+func (a *Authenticator) Authorize(token, action string) (Token, error) {
+	if !a.Enabled() {
+		return Token{}, nil
+	}
+
+	t, ok := a.tokens[sha256.Sum256([]byte(token))]
+	if token == "" || !ok {
+		return Token{}, ErrUnauthenticated
+	}
+	if roleLevels[t.Role] < roleLevels[ActionRole(action)] {
+		return Token{Name: t.Name, Role: t.Role}, ErrForbidden
+	}
+	return Token{Name: t.Name, Role: t.Role}, nil
+}
+
+// BearerToken returns the token of an Authorization value of the Bearer scheme
+func BearerToken(authorization string) string {
+	const scheme = "bearer "
+	if len(authorization) < len(scheme) || !strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(scheme):])
+}
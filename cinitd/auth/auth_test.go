@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	a, err := NewAuthenticator([]Token{
+		{Name: "view", Role: RoleViewer, Token: "v1ew"},
+		{Name: "ops", Role: RoleOperator, Token: "0ps"},
+		{Name: "root", Role: RoleAdmin, Token: "adm1n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		token, action string
+		name          string
+		err           error
+	}{
+		{token: "", action: "status", err: ErrUnauthenticated},
+		{token: "guess", action: "status", err: ErrUnauthenticated},
+		// Tokens only match as a whole
+		{token: "v1e", action: "status", err: ErrUnauthenticated},
+		{token: "v1eww", action: "status", err: ErrUnauthenticated},
+		{token: "v1ew", action: "status", name: "view"},
+		{token: "v1ew", action: "events", name: "view"},
+		{token: "v1ew", action: "stop", name: "view", err: ErrForbidden},
+		{token: "v1ew", action: "register", name: "view", err: ErrForbidden},
+		{token: "0ps", action: "logs", name: "ops"},
+		{token: "0ps", action: "restart", name: "ops"},
+		{token: "0ps", action: "delete", name: "ops", err: ErrForbidden},
+		{token: "adm1n", action: "register", name: "root"},
+		{token: "adm1n", action: "scale", name: "root"},
+		// Unknown actions need the admin role
+		{token: "0ps", action: "reboot", name: "ops", err: ErrForbidden},
+		{token: "adm1n", action: "reboot", name: "root"},
+	}
+	for _, tt := range tests {
+		token, err := a.Authorize(tt.token, tt.action)
+		if err != tt.err {
+			t.Errorf("%q %s: error = %v, want %v", tt.token, tt.action, err, tt.err)
+		}
+		if token.Name != tt.name {
+			t.Errorf("%q %s: token name %q, want %q", tt.token, tt.action, token.Name, tt.name)
+		}
+		if token.Token != "" {
+			t.Errorf("%q %s: the token is returned", tt.token, tt.action)
+		}
+	}
+}
+
+func TestRoleOrder(t *testing.T) {
+	roles := Roles()
+	for i := 1; i < len(roles); i++ {
+		if roleLevels[roles[i-1]] >= roleLevels[roles[i]] {
+			t.Errorf("%s is not below %s", roles[i-1], roles[i])
+		}
+	}
+	for action, role := range actionRoles {
+		if _, ok := roleLevels[role]; !ok {
+			t.Errorf("action %s needs unknown role %s", action, role)
+		}
+	}
+}
+
+func TestWithoutTokens(t *testing.T) {
+	var none *Authenticator
+	empty, err := NewAuthenticator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []*Authenticator{none, empty} {
+		if a.Enabled() {
+			t.Error("authenticator without tokens is enabled")
+		}
+		if _, err := a.Authorize("", "register"); err != nil {
+			t.Errorf("request rejected without tokens: %s", err)
+		}
+	}
+}
+
+func TestNewAuthenticatorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []Token
+	}{
+		{name: "no name", tokens: []Token{{Role: RoleAdmin, Token: "t"}}},
+		{name: "no token", tokens: []Token{{Name: "a", Role: RoleAdmin}}},
+		{name: "unknown role", tokens: []Token{{Name: "a", Role: "root", Token: "t"}}},
+		{name: "same token", tokens: []Token{{Name: "a", Role: RoleAdmin, Token: "t"}, {Name: "b", Role: RoleViewer, Token: "t"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewAuthenticator(tt.tokens); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tokens, err := ParseEnv(map[string]string{
+		"CINIT_TOKEN_OPS":   "operator:0p:s",
+		"CINIT_TOKEN_ADMIN": "admin:adm1n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{Name: "admin", Role: RoleAdmin, Token: "adm1n"},
+		{Name: "ops", Role: RoleOperator, Token: "0p:s"},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("got %+v, want %+v", tokens, want)
+	}
+
+	if _, err := ParseEnv(map[string]string{"CINIT_TOKEN_BAD": "adm1n"}); err == nil {
+		t.Error("no error for a value without a role")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	data := `tokens:
+  - name: ci
+    role: operator
+    token: c1
+  - name: dashboard
+    role: viewer
+    token: d4sh
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{Name: "ci", Role: RoleOperator, Token: "c1"},
+		{Name: "dashboard", Role: RoleViewer, Token: "d4sh"},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("got %+v, want %+v", tokens, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("tokens:\n  - name: ci\n    secret: c1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil {
+		t.Error("no error for an unknown field")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer v1ew":   "v1ew",
+		"bearer  v1ew ": "v1ew",
+		"Basic dTpw":    "",
+		"v1ew":          "",
+		"":              "",
+	}
+	for in, want := range tests {
+		if got := BearerToken(in); got != want {
+			t.Errorf("BearerToken(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
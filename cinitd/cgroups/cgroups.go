@@ -0,0 +1,320 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	// DefaultMount is where the cgroup v2 hierarchy is mounted
+	DefaultMount = "/sys/fs/cgroup"
+
+	// cinitdGroup holds the processes that were in the root cgroup before the service
+	// cgroups were created, since cgroup v2 allows controllers only on cgroups without
+	// processes
+	cinitdGroup   = "cinitd"
+	servicesGroup = "services"
+)
+
+// controllers are the cgroup v2 controllers cinitd enables for the service cgroups
+var controllers = []string{"cpu", "io", "memory", "pids"}
+
+// Manager creates a cgroup for every service under a cgroup v2 directory, applies the
+// resource limits of the service and reads its usage
+type Manager struct {
+	root        string
+	controllers map[string]bool
+}
+
+// NewManager prepares root for the service cgroups. If root is empty, the cgroup of
+// cinitd is used. The returned manager is disabled when the error is not nil
+func NewManager(root string) (*Manager, error) {
+	m := &Manager{
+		controllers: make(map[string]bool),
+	}
+
+	if root == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return m, err
+		}
+		root = filepath.Join(DefaultMount, own)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return m, fmt.Errorf("%s is not a cgroup v2 directory: %s", root, err)
+	}
+	available := make(map[string]bool)
+	for _, c := range strings.Fields(string(data)) {
+		available[c] = true
+	}
+
+	if err := evacuate(root); err != nil {
+		return m, err
+	}
+
+	enable := make([]string, 0)
+	for _, c := range controllers {
+		if available[c] {
+			enable = append(enable, "+"+c)
+			m.controllers[c] = true
+		}
+	}
+
+	servicesDir := filepath.Join(root, servicesGroup)
+	if err := os.MkdirAll(servicesDir, 0755); err != nil {
+		return m, err
+	}
+	for _, dir := range []string{root, servicesDir} {
+		if len(enable) == 0 {
+			break
+		}
+		err := ioutil.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644)
+		if err != nil {
+			return m, fmt.Errorf("could not enable controllers in %s: %s", dir, err)
+		}
+	}
+
+	m.root = root
+	return m, nil
+}
+
+// ownCgroup returns the cgroup v2 path of cinitd relative to the cgroup mount
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			return path, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cinitd does not run in a cgroup v2 hierarchy")
+}
+
+// evacuate moves the processes of root to a leaf cgroup
+func evacuate(root string) error {
+	data, err := ioutil.ReadFile(filepath.Join(root, "cgroup.procs"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	pids := strings.Fields(string(data))
+	if len(pids) == 0 {
+		return nil
+	}
+
+	leaf := filepath.Join(root, cinitdGroup)
+	if err := os.MkdirAll(leaf, 0755); err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		err := ioutil.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(pid), 0644)
+		if err != nil && !os.IsNotExist(err) {
+			// Processes may exit while they are moved
+			if _, serr := os.Stat(filepath.Join("/proc", pid)); serr == nil {
+				return fmt.Errorf("could not move process %s to %s: %s", pid, leaf, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether service cgroups are created
+func (m *Manager) Enabled() bool {
+	return m != nil && m.root != ""
+}
+
+func (m *Manager) dir(name string) string {
+	return filepath.Join(m.root, servicesGroup, name)
+}
+
+// Prepare creates the cgroup of a service and writes its limits, before the service is
+// started. Limits that are not set are reset to their defaults. It returns the open
+// directory of the cgroup, for starting the process of the service inside it, or nil if
+// the manager is disabled. The caller closes the directory
+func (m *Manager) Prepare(name string, r *models.Resources) (*os.File, error) {
+	if !m.Enabled() {
+		if r != nil {
+			return nil, fmt.Errorf("resources are set but cgroup v2 is not available")
+		}
+		return nil, nil
+	}
+	if r == nil {
+		r = &models.Resources{}
+	}
+
+	dir := m.dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	memoryMax, err := ParseMemory(r.MemoryMax)
+	if err != nil {
+		return nil, err
+	}
+	cpuMax, err := ParseCPU(r.CPUMax)
+	if err != nil {
+		return nil, err
+	}
+	pidsMax, ioWeight := "max", "default 100"
+	if r.PidsMax > 0 {
+		pidsMax = strconv.FormatInt(r.PidsMax, 10)
+	}
+	if r.IOWeight > 0 {
+		ioWeight = fmt.Sprintf("default %d", r.IOWeight)
+	}
+
+	limits := []struct {
+		controller, file, value string
+		set                     bool
+	}{
+		{"memory", "memory.max", memoryMax, r.MemoryMax != ""},
+		{"cpu", "cpu.max", cpuMax, r.CPUMax != ""},
+		{"pids", "pids.max", pidsMax, r.PidsMax > 0},
+		{"io", "io.weight", ioWeight, r.IOWeight > 0},
+	}
+	for _, l := range limits {
+		if !m.controllers[l.controller] {
+			if l.set {
+				return nil, fmt.Errorf("%s: the %s controller is not available", l.file, l.controller)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, l.file), []byte(l.value), 0644); err != nil {
+			return nil, fmt.Errorf("%s: %s", l.file, err)
+		}
+	}
+
+	return os.Open(dir)
+}
+
+// Usage reads the memory, CPU time and number of processes of a service cgroup
+func (m *Manager) Usage(name string) (*models.ResourceUsage, error) {
+	if !m.Enabled() {
+		return nil, nil
+	}
+
+	dir := m.dir(name)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	usage := &models.ResourceUsage{}
+	if v, err := readInt(filepath.Join(dir, "memory.current")); err == nil {
+		usage.Memory = v
+	}
+	if v, err := readInt(filepath.Join(dir, "pids.current")); err == nil {
+		usage.Pids = v
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "usage_usec" {
+				if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+					usage.CPUTime = models.Duration(time.Duration(v) * time.Microsecond)
+				}
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+// Remove deletes the cgroup of a service. The cgroup must not have processes
+func (m *Manager) Remove(name string) error {
+	if !m.Enabled() {
+		return nil
+	}
+	err := os.Remove(m.dir(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func readInt(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// ParseMemory converts a memory limit in bytes with an optional K, M, G or T suffix
+// to the memory.max format. An empty limit or max means no limit
+func ParseMemory(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "max" {
+		return "max", nil
+	}
+
+	value, multiplier := s, int64(1)
+	suffixes := map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+	if m, ok := suffixes[strings.ToUpper(s[len(s)-1:])[0]]; ok {
+		value, multiplier = s[:len(s)-1], m
+	}
+
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v <= 0 {
+		return "", fmt.Errorf("memoryMax: %s is not a valid memory limit", s)
+	}
+	return strconv.FormatInt(v*multiplier, 10), nil
+}
+
+// ParseCPU checks a limit in the cpu.max format, a quota in microseconds (or max)
+// optionally followed by a period in microseconds. An empty limit means no limit
+func ParseCPU(s string) (string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return "max", nil
+	}
+	if len(fields) > 2 {
+		return "", fmt.Errorf("cpuMax: %s is not in the \"quota [period]\" format", s)
+	}
+	if fields[0] != "max" {
+		if v, err := strconv.ParseInt(fields[0], 10, 64); err != nil || v <= 0 {
+			return "", fmt.Errorf("cpuMax: quota %s is not valid", fields[0])
+		}
+	}
+	if len(fields) == 2 {
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err != nil || v <= 0 {
+			return "", fmt.Errorf("cpuMax: period %s is not valid", fields[1])
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// Validate checks the resources of a service
+func Validate(r *models.Resources) error {
+	if _, err := ParseMemory(r.MemoryMax); err != nil {
+		return err
+	}
+	if _, err := ParseCPU(r.CPUMax); err != nil {
+		return err
+	}
+	if r.PidsMax < 0 {
+		return fmt.Errorf("pidsMax can not be negative")
+	}
+	if r.IOWeight < 0 || r.IOWeight > 10000 {
+		return fmt.Errorf("ioWeight must be between 1 and 10000")
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// fakeCgroupfs creates a cgroup root with the given controllers and processes. Files
+// written by the manager are plain files, so they can be read back
+func fakeCgroupfs(t *testing.T, controllers, procs string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cgroup.controllers"), controllers)
+	writeFile(t, filepath.Join(root, "cgroup.procs"), procs)
+	return root
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNewManager(t *testing.T) {
+	root := fakeCgroupfs(t, "cpuset cpu io memory hugetlb pids", "")
+
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Enabled() {
+		t.Fatal("manager is disabled")
+	}
+
+	for _, dir := range []string{root, filepath.Join(root, servicesGroup)} {
+		got := readFile(t, filepath.Join(dir, "cgroup.subtree_control"))
+		if got != "+cpu +io +memory +pids" {
+			t.Errorf("%s: subtree_control is %q", dir, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, cinitdGroup)); !os.IsNotExist(err) {
+		t.Errorf("cinitd cgroup created for a root without processes")
+	}
+}
+
+func TestNewManagerEvacuatesRoot(t *testing.T) {
+	pid := strings.TrimSpace(readFile(t, "/proc/self/stat"))
+	pid = pid[:strings.IndexByte(pid, ' ')]
+	root := fakeCgroupfs(t, "memory", pid+"\n")
+
+	if _, err := NewManager(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(root, cinitdGroup, "cgroup.procs")); got != pid {
+		t.Errorf("cinitd cgroup.procs is %q, want %q", got, pid)
+	}
+}
+
+func TestNewManagerWithoutCgroupV2(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err == nil {
+		t.Fatal("no error for a directory without cgroup.controllers")
+	}
+	if m.Enabled() {
+		t.Error("manager is enabled")
+	}
+	if _, err := m.Prepare("web", &models.Resources{MemoryMax: "1G"}); err == nil {
+		t.Error("resources accepted by a disabled manager")
+	}
+	if cgroup, err := m.Prepare("web", nil); cgroup != nil || err != nil {
+		t.Errorf("disabled manager returned %v, %v for a service without resources", cgroup, err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	root := fakeCgroupfs(t, "cpu io memory pids", "")
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cgroup, err := m.Prepare("web", &models.Resources{
+		MemoryMax: "512M",
+		CPUMax:    "50000 100000",
+		PidsMax:   128,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cgroup.Close()
+
+	dir := filepath.Join(root, servicesGroup, "web")
+	if cgroup.Name() != dir {
+		t.Errorf("cgroup directory is %s, want %s", cgroup.Name(), dir)
+	}
+	want := map[string]string{
+		"memory.max": "536870912",
+		"cpu.max":    "50000 100000",
+		"pids.max":   "128",
+		"io.weight":  "default 100",
+	}
+	for file, value := range want {
+		if got := readFile(t, filepath.Join(dir, file)); got != value {
+			t.Errorf("%s is %q, want %q", file, got, value)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cgroup.procs")); !os.IsNotExist(err) {
+		t.Error("Prepare wrote cgroup.procs, processes must be cloned into the cgroup")
+	}
+
+	// Limits that are removed from a service are reset
+	cgroup2, err := m.Prepare("web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroup2.Close()
+	if got := readFile(t, filepath.Join(dir, "memory.max")); got != "max" {
+		t.Errorf("memory.max is %q after the limit was removed", got)
+	}
+}
+
+func TestPrepareMissingController(t *testing.T) {
+	m, err := NewManager(fakeCgroupfs(t, "memory", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Prepare("web", &models.Resources{CPUMax: "max"}); err == nil {
+		t.Error("cpuMax accepted without the cpu controller")
+	}
+	cgroup, err := m.Prepare("web", &models.Resources{MemoryMax: "1G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroup.Close()
+}
+
+func TestUsage(t *testing.T) {
+	root := fakeCgroupfs(t, "cpu memory pids", "")
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Usage("web"); err == nil {
+		t.Error("no error for a service without a cgroup")
+	}
+
+	cgroup, err := m.Prepare("web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroup.Close()
+	dir := filepath.Join(root, servicesGroup, "web")
+	writeFile(t, filepath.Join(dir, "memory.current"), "35274752\n")
+	writeFile(t, filepath.Join(dir, "pids.current"), "4\n")
+	writeFile(t, filepath.Join(dir, "cpu.stat"), "usage_usec 1520000\nuser_usec 1000000\nsystem_usec 520000\n")
+
+	usage, err := m.Usage("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.ResourceUsage{
+		Memory:  35274752,
+		Pids:    4,
+		CPUTime: models.Duration(1520 * time.Millisecond),
+	}
+	if *usage != want {
+		t.Errorf("usage is %+v, want %+v", *usage, want)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	root := fakeCgroupfs(t, "memory", "")
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Remove("web"); err != nil {
+		t.Errorf("removing a missing cgroup: %s", err)
+	}
+
+	// cgroupfs removes the interface files of a cgroup with it, a fake directory must
+	// be empty
+	dir := filepath.Join(root, servicesGroup, "web")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("web"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("cgroup was not removed")
+	}
+
+	var disabled *Manager
+	if err := disabled.Remove("web"); err != nil {
+		t.Errorf("disabled manager: %s", err)
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{in: "", want: "max"},
+		{in: "max", want: "max"},
+		{in: "1024", want: "1024"},
+		{in: " 2K ", want: "2048"},
+		{in: "512M", want: "536870912"},
+		{in: "1g", want: "1073741824"},
+		{in: "1T", want: "1099511627776"},
+		{in: "0", err: true},
+		{in: "-1M", err: true},
+		{in: "1.5G", err: true},
+		{in: "M", err: true},
+		{in: "10X", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMemory(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseMemory(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMemory(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCPU(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{in: "", want: "max"},
+		{in: "max", want: "max"},
+		{in: "50000", want: "50000"},
+		{in: "50000 100000", want: "50000 100000"},
+		{in: "  max   100000 ", want: "max 100000"},
+		{in: "0", err: true},
+		{in: "half", err: true},
+		{in: "50000 0", err: true},
+		{in: "50000 max", err: true},
+		{in: "1 2 3", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCPU(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseCPU(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCPU(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package channels
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,6 +12,7 @@ type Remote struct {
 	Data        chan chan []byte
 	t           bool
 	DataTimeOut time.Duration
+	timeouts    uint64
 }
 
 func NewRemoteChannel(dt int) *Remote {
@@ -25,6 +28,49 @@ func (r *Remote) Push(d chan []byte) {
 	r.Unlock()
 }
 
+// Request sends a request to the ServiceOperator and returns its reply. The reply is
+// framed by the 0x0 and 0xF markers of the ServiceOperator
+func (r *Remote) Request(body []byte) ([]byte, error) {
+	rChan := make(chan []byte)
+
+	r.Push(rChan)
+	reply := <-rChan
+	if string(reply) != "0x0" {
+		return nil, fmt.Errorf("rChan init was not 0x0")
+	}
+
+	rChan <- body
+
+	select {
+	case reply = <-rChan:
+	case <-time.After(r.DataTimeOut):
+		r.Timeout()
+		return nil, fmt.Errorf("Service channel did not respond within %s. Closing connection", r.DataTimeOut)
+	}
+
+	select {
+	case end := <-rChan:
+		if string(end) != "0xF" {
+			return reply, fmt.Errorf("server error, expected 0xF but received %s", end)
+		}
+	case <-time.After(10 * time.Second):
+		r.Timeout()
+		return reply, fmt.Errorf("Service channel did not respond within 10 seconds. Done waiting")
+	}
+
+	return reply, nil
+}
+
+// Timeout counts a wait on the channel that timed out
+func (r *Remote) Timeout() {
+	atomic.AddUint64(&r.timeouts, 1)
+}
+
+// Timeouts returns the number of waits on the channel that timed out
+func (r *Remote) Timeouts() uint64 {
+	return atomic.LoadUint64(&r.timeouts)
+}
+
 func (r *Remote) Term(t bool) {
 	r.t = t
 	if r.t {
@@ -2,6 +2,7 @@ package channels
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ulfox/cinit/cinitd/models"
@@ -12,6 +13,7 @@ type Service struct {
 	Data                       chan models.Service
 	Action                     chan chan models.ServiceAction
 	DataTimeOut, ActionTimeOut time.Duration
+	timeouts                   uint64
 }
 
 func NewServiceChannel(dt, at int) *Service {
@@ -35,6 +37,16 @@ func (r *Service) PushSA(d chan models.ServiceAction) {
 	r.Unlock()
 }
 
+// Timeout counts a wait on the channel that timed out
+func (r *Service) Timeout() {
+	atomic.AddUint64(&r.timeouts, 1)
+}
+
+// Timeouts returns the number of waits on the channel that timed out
+func (r *Service) Timeouts() uint64 {
+	return atomic.LoadUint64(&r.timeouts)
+}
+
 func (r *Service) Close() {
 	r.Lock()
 	close(r.Data)
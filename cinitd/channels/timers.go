@@ -1 +1,17 @@
 package channels
+
+import (
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// Timer carries the scheduled services whose timer has fired. The timers of the
+// schedules send on Data directly, so that they can give up when they are canceled
+type Timer struct {
+	Data chan models.Service
+}
+
+func NewTimerChannel() *Timer {
+	return &Timer{
+		Data: make(chan models.Service),
+	}
+}
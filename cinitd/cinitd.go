@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
+	"github.com/ulfox/cinit/cinitd/cgroups"
 	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/definitions"
+	"github.com/ulfox/cinit/cinitd/events"
+	g "github.com/ulfox/cinit/cinitd/listeners/grpc/server"
 	h "github.com/ulfox/cinit/cinitd/listeners/http/server"
-	"github.com/ulfox/cinit/cinitd/listeners/uds"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/metrics"
 	"github.com/ulfox/cinit/cinitd/models"
 	"github.com/ulfox/cinit/cinitd/processes"
 	"github.com/ulfox/cinit/cinitd/services"
+	"github.com/ulfox/cinit/cinitd/state"
 	"github.com/ulfox/cinit/cinitd/utils"
-	udsc "github.com/ulfox/cinit/cli/uds"
 )
 
 var (
@@ -28,11 +34,25 @@ var (
 )
 
 func main() {
+	processes.RunExecHelper()
+
 	cinitDevMode := flag.Bool("dev", false, "enable dev mode, to allow cinit to run if it is not pid 1")
-	unixSocket := flag.String("unix-socket", "/tmp/cinit.sock", "cinitd unix socket")
+	unixSocket := flag.String("unix-socket", "/tmp/cinit.sock", "cinitd unix socket, serving the gRPC API")
+	grpcAddr := flag.String("grpc-addr", "", "TCP address (host:port) to also serve the gRPC API on, disabled if empty")
 	httpPortArg := flag.String("http-port", "8081", "cinitd http listening port")
 	httpInterfaceArg := flag.String("http-listener", "127.0.0.1", "cinitd http listening interface")
 	logDir := flag.String("log-dir", "/var/log/cinitd", "services logdir")
+	servicesDir := flag.String("services-dir", "", "directory with service definitions (*.yaml, *.yml) to register on boot")
+	stateDir := flag.String("state-dir", "", "directory where registered services are kept across restarts, disabled if empty")
+	logMaxSize := flag.String("log-max-size", "", "default size (bytes, K, M or G suffix) at which service logs are rotated")
+	logMaxAge := flag.Duration("log-max-age", 0, "default age at which service logs are rotated")
+	logMaxFiles := flag.Int("log-max-files", 0, "default number of rotated service logs to keep, 0 keeps all")
+	logCompress := flag.Bool("log-compress", false, "gzip rotated service logs by default")
+	logTarget := flag.String("log-target", logs.TargetFile, "default destination of service output: file, console (stdout/stderr of cinitd) or both")
+	logTimestamps := flag.Bool("log-timestamps", false, "prefix service output written to the console with a timestamp")
+	eventHistory := flag.Int("event-history", 1000, "number of service events kept for clients resuming an event stream")
+	tokenFile := flag.String("token-file", "", "YAML file with the API tokens and their roles, the API needs no token if neither this nor CINIT_TOKEN_<NAME> variables are set")
+	cgroupRoot := flag.String("cgroup-root", "", "cgroup v2 directory for the service cgroups (default the cgroup of cinitd, disabled in dev mode)")
 	flag.Parse()
 
 	logger = logrus.New()
@@ -63,6 +83,25 @@ func main() {
 		log.Fatal("service logdir can not be empty")
 	}
 
+	logRotation := &models.LogRotation{
+		MaxSize:  *logMaxSize,
+		MaxAge:   models.Duration(*logMaxAge),
+		MaxFiles: *logMaxFiles,
+		Compress: logCompress,
+	}
+	if err := logs.Validate(logRotation); err != nil {
+		log.Fatalf("log rotation: %s", err)
+	}
+	var targetOK bool
+	for _, j := range logs.Targets() {
+		if j == *logTarget {
+			targetOK = true
+		}
+	}
+	if !targetOK {
+		log.Fatalf("log target %s not supported", *logTarget)
+	}
+
 	if !(*cinitDevMode) {
 		watchAll = true
 		log.Warnf("Watchall is enabled. On stop cinitd will send SIGTERM and SIGKILL (on timeout) to all processes")
@@ -76,6 +115,32 @@ func main() {
 
 	log.Info("Initiated")
 
+	authenticator, err := loadTokens(*tokenFile)
+	if err != nil {
+		log.Fatalf("could not load API tokens: %s", err)
+	}
+	if !authenticator.Enabled() {
+		log.Warn("API authentication is disabled, every client that can reach the listeners may manage services")
+	}
+
+	var cgroupManager *cgroups.Manager
+	if *cgroupRoot != "" || !(*cinitDevMode) {
+		var err error
+		cgroupManager, err = cgroups.NewManager(*cgroupRoot)
+		if err != nil {
+			log.Warnf("Service cgroups are disabled: %s", err)
+		}
+	}
+
+	logManager := logs.NewManager(
+		*logDir,
+		logRotation,
+		*logTarget,
+		logs.NewConsole(os.Stdout, os.Stderr, *logTimestamps),
+	)
+
+	eventBus := events.NewBus(*eventHistory)
+
 	sysSigs := utils.NewOSSignal()
 	prcSigStop := make(chan bool)
 	soSigStop := make(chan bool)
@@ -85,7 +150,7 @@ func main() {
 	// Async Groups
 	var processOperatorWaitGroup sync.WaitGroup
 	var serviceOperatorWaitGroup sync.WaitGroup
-	var unixServerWaitGroup sync.WaitGroup
+	var grpcServerWaitGroup sync.WaitGroup
 	var httpServerWaitGroup sync.WaitGroup
 
 	serviceOperator := services.NewProcessOperator(
@@ -100,46 +165,50 @@ func main() {
 		logger,
 		watchAll,
 		serviceChan,
-		*logDir,
+		logManager,
+		cgroupManager,
+		eventBus,
 	)
 	go processOperator.Init(&processOperatorWaitGroup)
 	processOperator.Ready()
 
-	udsServerCtx, udsServerCancel := context.WithCancel(context.Background())
-	unixServer := uds.NewServerFactory(udsServerCtx, remoteChan, sockAddr, logger, &unixServerWaitGroup)
-	unixServer.ListenBackground()
+	metricsRegistry := metrics.NewRegistry(processOperator, remoteChan, serviceChan)
 
-	httpServerCtx, httpServerCancel := context.WithCancel(context.Background())
-	httpServer := h.NewServerFactory(httpServerCtx, remoteChan, port, listenAt, logger, &httpServerWaitGroup)
-	httpServer.ListenBackground()
-
-	sysSigs.Wait()
-	log.Infof("Interrupted")
-
-	udsServerCancel()
-
-	// empty message will cause the server to loop over and catch the canceled context
-	go func() {
-		dataBytes, err := json.Marshal(models.Service{T: "shutdown"})
+	if *stateDir != "" {
+		store, err := state.Open(*stateDir)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("could not open state dir %s: %s", *stateDir, err)
 		}
-
-		client := udsc.NewClientFactory(sockAddr, logger)
-		err = client.OpenCom()
-		if err != nil {
-			log.Fatal(err)
+		if err := serviceOperator.UseStore(store); err != nil {
+			log.Fatalf("could not load registered services: %s", err)
 		}
+	}
 
-		err = client.SendByteBatch(dataBytes)
+	if *servicesDir != "" {
+		bootServices, err := definitions.ReadDir(*servicesDir)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("could not load services from %s: %s", *servicesDir, err)
 		}
-		client.CloseCom()
+		if err := serviceOperator.Load(bootServices); err != nil {
+			log.Fatalf("could not load services from %s: %s", *servicesDir, err)
+		}
+	}
+	loadEnvServices(serviceOperator, log)
+	serviceOperator.Restore()
+
+	grpcServerCtx, grpcServerCancel := context.WithCancel(context.Background())
+	grpcServer := g.NewServerFactory(grpcServerCtx, remoteChan, logManager, eventBus, metricsRegistry, authenticator, sockAddr, *grpcAddr, logger, &grpcServerWaitGroup)
+	grpcServer.ListenBackground()
+
+	httpServerCtx, httpServerCancel := context.WithCancel(context.Background())
+	httpServer := h.NewServerFactory(httpServerCtx, remoteChan, logManager, eventBus, metricsRegistry, authenticator, port, listenAt, logger, &httpServerWaitGroup)
+	httpServer.ListenBackground()
 
-	}()
+	sysSigs.Wait()
+	log.Infof("Interrupted")
 
-	unixServerWaitGroup.Wait()
+	grpcServerCancel()
+	grpcServerWaitGroup.Wait()
 
 	httpServerCancel()
 	httpServerWaitGroup.Wait()
@@ -156,5 +225,51 @@ func main() {
 	remoteChan.Close()
 	serviceChan.Close()
 
+	if processOperator.Aborted() {
+		log.Error("Boot aborted by a failed oneshot service")
+		os.Exit(1)
+	}
+
 	log.Infof("Bye!")
 }
+
+// loadEnvServices registers the services defined in CINIT_SERVICE_<NAME> variables. Every
+// variable holds base64 encoded YAML with one or more service definitions. Variables that
+// can not be decoded or registered are reported and skipped
+func loadEnvServices(serviceOperator *services.ServiceOperator, log *logrus.Entry) {
+	env := utils.GetPrefixedEnv("CINIT_SERVICE_")
+
+	names := make([]string, 0, len(env))
+	for k := range env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		envServices, err := definitions.ParseBase64(env[name], name)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if err := serviceOperator.Load(envServices); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// loadTokens returns an Authenticator for the tokens of file, if not empty, and of the
+// CINIT_TOKEN_<NAME> variables
+func loadTokens(file string) (*auth.Authenticator, error) {
+	tokens, err := auth.ParseEnv(utils.GetPrefixedEnv("CINIT_TOKEN_"))
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		fileTokens, err := auth.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(fileTokens, tokens...)
+	}
+	return auth.NewAuthenticator(tokens)
+}
@@ -0,0 +1,91 @@
+package definitions
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Args holds the arguments of a service. In YAML they are either a list, kept as is, or
+// a string that is split into words like a shell does, without any expansion
+type Args []string
+
+// UnmarshalYAML decodes a list of arguments or an arguments string
+func (a *Args) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*a = list
+		return nil
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	args, err := SplitArgs(s)
+	if err != nil {
+		return err
+	}
+	*a = args
+	return nil
+}
+
+// SplitArgs splits a string into words. Words are separated by whitespace. Single quotes
+// keep their content as is, double quotes keep it except for backslash escaped ", \ and $,
+// and outside of quotes a backslash escapes the next character. Quotes may produce empty
+// words
+func SplitArgs(s string) ([]string, error) {
+	args := make([]string, 0)
+
+	var word strings.Builder
+	var inWord, escaped bool
+	var quote rune
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' && r != '$' {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("args: unterminated %c quote in %s", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("args: trailing backslash in %s", s)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,66 @@
+package definitions
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "", want: []string{}},
+		{in: "   ", want: []string{}},
+		{in: "10000", want: []string{"10000"}},
+		{in: "  -g   'daemon off;'  ", want: []string{"-g", "daemon off;"}},
+		{in: `a "" ''`, want: []string{"a", "", ""}},
+		{in: `say "he said \"hi\""`, want: []string{"say", `he said "hi"`}},
+		{in: `"\$HOME \\ \n"`, want: []string{`$HOME \ \n`}},
+		{in: `'$HOME \"'`, want: []string{`$HOME \"`}},
+		{in: `a\ b c`, want: []string{"a b", "c"}},
+		{in: `pre"mid dle"post`, want: []string{"premid dlepost"}},
+		{in: "$1 $@ ${X}", want: []string{"$1", "$@", "${X}"}},
+		{in: "tab\tand\nnewline", want: []string{"tab", "and", "newline"}},
+		{in: `"open`, err: true},
+		{in: `'open`, err: true},
+		{in: `trailing\`, err: true},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("SplitArgs(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestArgsUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Args
+	}{
+		{in: `args: [-g, "daemon off;", ""]`, want: Args{"-g", "daemon off;", ""}},
+		{in: `args: -g "daemon off;" ""`, want: Args{"-g", "daemon off;", ""}},
+		{in: `args: 10000`, want: Args{"10000"}},
+		{in: `args: ["$PASSWORD"]`, want: Args{"$PASSWORD"}},
+	}
+	for _, tt := range tests {
+		var s struct {
+			Args Args `yaml:"args"`
+		}
+		if err := yaml.Unmarshal([]byte(tt.in), &s); err != nil {
+			t.Errorf("%s: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(s.Args, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.in, s.Args, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package definitions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ulfox/cinit/cinitd/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Service is the YAML definition of a cinitd service
+type Service struct {
+	Name     string            `yaml:"name"`
+	Command  string            `yaml:"command"`
+	Args     Args              `yaml:"args,omitempty"`
+	Shell    bool              `yaml:"shell,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	EnvFile  []string          `yaml:"envFile,omitempty"`
+	CleanEnv bool              `yaml:"cleanEnv,omitempty"`
+
+	User                string   `yaml:"user,omitempty"`
+	Group               string   `yaml:"group,omitempty"`
+	SupplementaryGroups []string `yaml:"supplementaryGroups,omitempty"`
+	WorkingDir          string   `yaml:"workingDir,omitempty"`
+
+	Restart string          `yaml:"restart,omitempty"`
+	Backoff *models.Backoff `yaml:"backoff,omitempty"`
+
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+
+	HealthCheck *models.HealthCheck `yaml:"healthCheck,omitempty"`
+
+	Type             string `yaml:"type,omitempty"`
+	SuccessExitCodes []int  `yaml:"successExitCodes,omitempty"`
+	AbortOnFailure   bool   `yaml:"abortOnFailure,omitempty"`
+
+	Schedule   string          `yaml:"schedule,omitempty"`
+	Overlap    string          `yaml:"overlap,omitempty"`
+	Jitter     models.Duration `yaml:"jitter,omitempty"`
+	RunHistory int             `yaml:"runHistory,omitempty"`
+
+	Resources *models.Resources `yaml:"resources,omitempty"`
+
+	Limits      map[string]string `yaml:"limits,omitempty"`
+	Nice        *int              `yaml:"nice,omitempty"`
+	OOMScoreAdj *int              `yaml:"oomScoreAdj,omitempty"`
+	CPUAffinity []int             `yaml:"cpuAffinity,omitempty"`
+
+	StopSignal         string          `yaml:"stopSignal,omitempty"`
+	StopTimeout        models.Duration `yaml:"stopTimeout,omitempty"`
+	SignalProcessGroup bool            `yaml:"signalProcessGroup,omitempty"`
+
+	ReloadSignal  string   `yaml:"reloadSignal,omitempty"`
+	ReloadCommand []string `yaml:"reloadCommand,omitempty"`
+
+	LogRotation *models.LogRotation `yaml:"logRotation,omitempty"`
+	LogTarget   string              `yaml:"logTarget,omitempty"`
+
+	Replicas int `yaml:"replicas,omitempty"`
+}
+
+// Model converts a YAML definition to the service model used by cinitd
+func (s *Service) Model() models.Service {
+	service := models.Service{
+		T:        "register",
+		Name:     s.Name,
+		Command:  s.Command,
+		Args:     s.Args,
+		Shell:    s.Shell,
+		Env:      s.Env,
+		EnvFile:  s.EnvFile,
+		CleanEnv: s.CleanEnv,
+
+		User:                s.User,
+		Group:               s.Group,
+		SupplementaryGroups: s.SupplementaryGroups,
+		WorkingDir:          s.WorkingDir,
+
+		Restart: s.Restart,
+		Backoff: s.Backoff,
+
+		DependsOn: s.DependsOn,
+
+		HealthCheck: s.HealthCheck,
+
+		ServiceType:      s.Type,
+		SuccessExitCodes: s.SuccessExitCodes,
+		AbortOnFailure:   s.AbortOnFailure,
+
+		Schedule:   s.Schedule,
+		Overlap:    s.Overlap,
+		Jitter:     s.Jitter,
+		RunHistory: s.RunHistory,
+
+		Resources: s.Resources,
+
+		Limits:      s.Limits,
+		Nice:        s.Nice,
+		OOMScoreAdj: s.OOMScoreAdj,
+		CPUAffinity: s.CPUAffinity,
+
+		StopSignal:         s.StopSignal,
+		StopTimeout:        s.StopTimeout,
+		SignalProcessGroup: s.SignalProcessGroup,
+
+		ReloadSignal:  s.ReloadSignal,
+		ReloadCommand: s.ReloadCommand,
+
+		LogRotation: s.LogRotation,
+		LogTarget:   s.LogTarget,
+
+		Replicas: s.Replicas,
+	}
+
+	return service
+}
+
+// Parse reads one or more YAML documents holding service definitions. Unknown fields
+// are rejected. Errors are prefixed with source, which is also recorded in every
+// returned service
+func Parse(data []byte, source string) ([]models.Service, error) {
+	services := make([]models.Service, 0)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.SetStrict(true)
+	for doc := 1; ; doc++ {
+		var s *Service
+		err := decoder.Decode(&s)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: document %d: %s", source, doc, err)
+		}
+		if s == nil {
+			continue
+		}
+
+		if s.Name == "" {
+			return nil, fmt.Errorf("%s: document %d: field name is required", source, doc)
+		}
+		if s.Command == "" {
+			return nil, fmt.Errorf("%s: service %s: field command is required", source, s.Name)
+		}
+
+		service := s.Model()
+		service.Source = source
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// ParseBase64 decodes a base64 (padded or not) string holding YAML service definitions
+// and parses them like Parse
+func ParseBase64(value, source string) ([]models.Service, error) {
+	value = strings.TrimSpace(value)
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return nil, fmt.Errorf("%s: value is not valid base64: %s", source, err)
+		}
+	}
+	return Parse(data, source)
+}
+
+// ReadFile parses the service definitions of a YAML file
+func ReadFile(path string) ([]models.Service, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+// ReadDir parses the service definitions of every .yaml and .yml file in dir, in
+// lexical order
+func ReadDir(dir string) ([]models.Service, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+
+	services := make([]models.Service, 0)
+	for _, name := range names {
+		s, err := ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, s...)
+	}
+
+	return services, nil
+}
@@ -0,0 +1,81 @@
+package definitions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadDir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"20-web.yml":           "name: web\ncommand: nginx\nargs: -g \"daemon off;\"\ndependsOn: [db]\n",
+		"10-db.yaml":           "name: db\ncommand: postgres\n---\nname: cache\ncommand: redis-server\n---\n",
+		"README.md":            "name: readme\n",
+		"30-OFF.YAML":          "name: upper\ncommand: upper\n",
+		"nested.yaml/svc.yaml": "name: nested\ncommand: nested\n",
+	})
+
+	services, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range services {
+		names = append(names, s.Name)
+		if s.T != "register" {
+			t.Errorf("%s has type %q", s.Name, s.T)
+		}
+	}
+	if got := strings.Join(names, ","); got != "db,cache,web,upper" {
+		t.Errorf("read %s, want db,cache,web,upper", got)
+	}
+	if services[0].Source != filepath.Join(dir, "10-db.yaml") {
+		t.Errorf("db has source %s", services[0].Source)
+	}
+	if web := services[2]; len(web.Args) != 2 || web.Args[0] != "-g" || len(web.DependsOn) != 1 {
+		t.Errorf("web is %+v", web)
+	}
+}
+
+func TestReadDirErrors(t *testing.T) {
+	tests := []struct {
+		name, data, err string
+	}{
+		{name: "unknown field", data: "name: web\ncommand: web\nport: 80\n", err: "web.yaml: document 1: "},
+		{name: "no name", data: "name: web\ncommand: web\n---\ncommand: web\n", err: "web.yaml: document 2: field name is required"},
+		{name: "no command", data: "name: web\n", err: "web.yaml: service web: field command is required"},
+		{name: "not yaml", data: "name: [web\n", err: "web.yaml: document 1: "},
+	}
+	for _, tt := range tests {
+		dir := writeFiles(t, map[string]string{"web.yaml": tt.data, "db.yaml": "name: db\ncommand: db\n"})
+		services, err := ReadDir(dir)
+		if err == nil {
+			t.Errorf("%s: read %+v", tt.name, services)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %q, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	if _, err := ReadDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("no error for a missing dir")
+	}
+}
@@ -10,8 +10,15 @@ func InternalServerError(w http.ResponseWriter) {
 	w.Write([]byte("Internal server error"))
 }
 
-// UnauthorizedError http internal server error
+// UnauthorizedError http unauthorized error
 func UnauthorizedError(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
 	w.WriteHeader(http.StatusUnauthorized)
 	w.Write([]byte("Unauthorized"))
 }
+
+// ForbiddenError http forbidden error
+func ForbiddenError(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte("Forbidden"))
+}
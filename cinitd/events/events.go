@@ -0,0 +1,152 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of events
+const (
+	Started    = "started"
+	Failed     = "failed"
+	Exited     = "exited"
+	Restarting = "restarting"
+	Health     = "health"
+	// GaveUp is published once a service reached its restart limits and is no longer
+	// restarted
+	GaveUp = "gave-up"
+)
+
+// subscriberBuffer is the number of events held for a subscriber. Subscribers that fall
+// further behind are dropped and have to resubscribe from their last sequence number
+const subscriberBuffer = 256
+
+// Event is a state change of a service. Seq increases by one with every event published
+// by a Bus, starting from 1 when cinitd starts. Boot identifies the run of cinitd that
+// published the event, so that clients can tell that the sequence numbers have restarted
+type Event struct {
+	Seq        uint64    `json:"seq"`
+	Boot       string    `json:"boot"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	Instance   string    `json:"instance,omitempty"`
+	PUID       string    `json:"puid,omitempty"`
+	PID        int       `json:"pid,omitempty"`
+	ExitStatus string    `json:"exitStatus,omitempty"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	Health     string    `json:"health,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// Bus delivers the events of the services to its subscribers and keeps the last events,
+// so that subscribers can resume after reconnecting
+type Bus struct {
+	sync.Mutex
+	boot    string
+	seq     uint64
+	size    int
+	history []Event
+	subs    map[*Subscription]bool
+}
+
+// NewBus returns a Bus keeping the last history events
+func NewBus(history int) *Bus {
+	return &Bus{
+		boot: uuid.New().String(),
+		size: history,
+		subs: make(map[*Subscription]bool),
+	}
+}
+
+// Publish assigns the next sequence number to e and delivers it. Publish never blocks
+func (b *Bus) Publish(e Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.seq++
+	e.Seq = b.seq
+	e.Boot = b.boot
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if b.size > 0 {
+		if len(b.history) >= b.size {
+			b.history = append(b.history[:0], b.history[len(b.history)-b.size+1:]...)
+		}
+		b.history = append(b.history, e)
+	}
+
+	for s := range b.subs {
+		if !s.matches(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			delete(b.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Subscription receives the events published after it has been created. C is closed
+// when the subscription is closed or when the subscriber falls behind
+type Subscription struct {
+	C    <-chan Event
+	c    chan Event
+	bus  *Bus
+	name string
+}
+
+func (s *Subscription) matches(e Event) bool {
+	return s.name == "" || s.name == e.Name
+}
+
+// Boot returns the boot ID of the events published by the Bus
+func (b *Bus) Boot() string {
+	return b.boot
+}
+
+// Subscribe returns the kept events with a sequence number greater than after and a
+// subscription to the events published from then on. A client resuming with the boot ID
+// of an earlier run of cinitd gets all kept events, as the sequence numbers restarted.
+// name limits the events to a service, all services are returned if it is empty
+func (b *Bus) Subscribe(after uint64, boot, name string) ([]Event, *Subscription) {
+	c := make(chan Event, subscriberBuffer)
+	s := &Subscription{
+		C:    c,
+		c:    c,
+		bus:  b,
+		name: name,
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if boot != "" && boot != b.boot {
+		after = 0
+	}
+
+	replay := make([]Event, 0)
+	for _, e := range b.history {
+		if e.Seq > after && s.matches(e) {
+			replay = append(replay, e)
+		}
+	}
+	b.subs[s] = true
+	return replay, s
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	if s.bus.subs[s] {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
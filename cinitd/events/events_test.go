@@ -0,0 +1,113 @@
+package events
+
+import (
+	"testing"
+)
+
+func seqs(events []Event) []uint64 {
+	out := make([]uint64, 0, len(events))
+	for _, e := range events {
+		out = append(out, e.Seq)
+	}
+	return out
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := NewBus(3)
+	for _, name := range []string{"web", "db", "web", "web", "db"} {
+		b.Publish(Event{Type: Started, Name: name})
+	}
+
+	tests := []struct {
+		after uint64
+		name  string
+		want  []uint64
+	}{
+		{want: []uint64{3, 4, 5}},
+		{after: 3, want: []uint64{4, 5}},
+		{after: 5, want: []uint64{}},
+		{name: "web", want: []uint64{3, 4}},
+		{after: 3, name: "db", want: []uint64{5}},
+	}
+	for _, tt := range tests {
+		replay, sub := b.Subscribe(tt.after, b.Boot(), tt.name)
+		sub.Close()
+		if got := seqs(replay); !equal(got, tt.want) {
+			t.Errorf("after %d, name %q: replayed %v, want %v", tt.after, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeAfterRestart(t *testing.T) {
+	old := NewBus(10)
+	for i := 0; i < 5; i++ {
+		old.Publish(Event{Type: Started, Name: "web"})
+	}
+	_, sub := old.Subscribe(0, "", "")
+	sub.Close()
+
+	// cinitd restarted, its sequence numbers start from 1 again
+	b := NewBus(10)
+	b.Publish(Event{Type: Started, Name: "web"})
+	b.Publish(Event{Type: Exited, Name: "web"})
+	if b.Boot() == old.Boot() {
+		t.Fatal("two buses have the same boot ID")
+	}
+
+	replay, sub := b.Subscribe(5, old.Boot(), "")
+	sub.Close()
+	if got := seqs(replay); !equal(got, []uint64{1, 2}) {
+		t.Errorf("resuming from an earlier boot replayed %v, want all kept events", got)
+	}
+	for _, e := range replay {
+		if e.Boot != b.Boot() {
+			t.Errorf("event %d has boot ID %q, want %q", e.Seq, e.Boot, b.Boot())
+		}
+	}
+
+	// Without a boot ID the sequence number is trusted
+	replay, sub = b.Subscribe(1, "", "")
+	sub.Close()
+	if got := seqs(replay); !equal(got, []uint64{2}) {
+		t.Errorf("resuming without a boot ID replayed %v", got)
+	}
+}
+
+func TestSubscriberFallsBehind(t *testing.T) {
+	b := NewBus(0)
+	_, slow := b.Subscribe(0, "", "")
+	_, other := b.Subscribe(0, "", "db")
+	defer other.Close()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(Event{Type: Started, Name: "web"})
+	}
+
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	// Closing a dropped subscription is harmless
+	slow.Close()
+
+	select {
+	case e, ok := <-other.C:
+		t.Errorf("subscriber of another service got %+v, %v", e, ok)
+	default:
+	}
+}
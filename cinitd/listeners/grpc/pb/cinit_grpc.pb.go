@@ -0,0 +1,577 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: cinit.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Cinit_Register_FullMethodName = "/cinit.v1.Cinit/Register"
+	Cinit_List_FullMethodName     = "/cinit.v1.Cinit/List"
+	Cinit_Status_FullMethodName   = "/cinit.v1.Cinit/Status"
+	Cinit_Start_FullMethodName    = "/cinit.v1.Cinit/Start"
+	Cinit_Stop_FullMethodName     = "/cinit.v1.Cinit/Stop"
+	Cinit_Restart_FullMethodName  = "/cinit.v1.Cinit/Restart"
+	Cinit_Reload_FullMethodName   = "/cinit.v1.Cinit/Reload"
+	Cinit_Delete_FullMethodName   = "/cinit.v1.Cinit/Delete"
+	Cinit_Signal_FullMethodName   = "/cinit.v1.Cinit/Signal"
+	Cinit_Scale_FullMethodName    = "/cinit.v1.Cinit/Scale"
+	Cinit_Logs_FullMethodName     = "/cinit.v1.Cinit/Logs"
+	Cinit_Events_FullMethodName   = "/cinit.v1.Cinit/Events"
+)
+
+// CinitClient is the client API for Cinit service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CinitClient interface {
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterReply, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error)
+	Status(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Start(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Stop(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Restart(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Reload(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Delete(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Signal(ctx context.Context, in *SignalRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	Scale(ctx context.Context, in *ScaleRequest, opts ...grpc.CallOption) (*ServiceStatus, error)
+	// Logs streams the output of a service, or of all its replicas
+	Logs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (Cinit_LogsClient, error)
+	// Events streams the events of the services. The kept events after the sequence number
+	// after are sent first
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (Cinit_EventsClient, error)
+}
+
+type cinitClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCinitClient(cc grpc.ClientConnInterface) CinitClient {
+	return &cinitClient{cc}
+}
+
+func (c *cinitClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterReply, error) {
+	out := new(RegisterReply)
+	err := c.cc.Invoke(ctx, Cinit_Register_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error) {
+	out := new(ListReply)
+	err := c.cc.Invoke(ctx, Cinit_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Status(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Status_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Start(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Start_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Stop(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Stop_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Restart(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Restart_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Reload(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Reload_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Delete(ctx context.Context, in *ServiceRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Signal(ctx context.Context, in *SignalRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Signal_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Scale(ctx context.Context, in *ScaleRequest, opts ...grpc.CallOption) (*ServiceStatus, error) {
+	out := new(ServiceStatus)
+	err := c.cc.Invoke(ctx, Cinit_Scale_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cinitClient) Logs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (Cinit_LogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Cinit_ServiceDesc.Streams[0], Cinit_Logs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cinitLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cinit_LogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type cinitLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *cinitLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cinitClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (Cinit_EventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Cinit_ServiceDesc.Streams[1], Cinit_Events_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cinitEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cinit_EventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type cinitEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *cinitEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CinitServer is the server API for Cinit service.
+// All implementations must embed UnimplementedCinitServer
+// for forward compatibility
+type CinitServer interface {
+	Register(context.Context, *RegisterRequest) (*RegisterReply, error)
+	List(context.Context, *ListRequest) (*ListReply, error)
+	Status(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Start(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Stop(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Restart(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Reload(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Delete(context.Context, *ServiceRequest) (*ServiceStatus, error)
+	Signal(context.Context, *SignalRequest) (*ServiceStatus, error)
+	Scale(context.Context, *ScaleRequest) (*ServiceStatus, error)
+	// Logs streams the output of a service, or of all its replicas
+	Logs(*LogsRequest, Cinit_LogsServer) error
+	// Events streams the events of the services. The kept events after the sequence number
+	// after are sent first
+	Events(*EventsRequest, Cinit_EventsServer) error
+	mustEmbedUnimplementedCinitServer()
+}
+
+// UnimplementedCinitServer must be embedded to have forward compatible implementations.
+type UnimplementedCinitServer struct {
+}
+
+func (UnimplementedCinitServer) Register(context.Context, *RegisterRequest) (*RegisterReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedCinitServer) List(context.Context, *ListRequest) (*ListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedCinitServer) Status(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedCinitServer) Start(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedCinitServer) Stop(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedCinitServer) Restart(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restart not implemented")
+}
+func (UnimplementedCinitServer) Reload(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reload not implemented")
+}
+func (UnimplementedCinitServer) Delete(context.Context, *ServiceRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedCinitServer) Signal(context.Context, *SignalRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Signal not implemented")
+}
+func (UnimplementedCinitServer) Scale(context.Context, *ScaleRequest) (*ServiceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scale not implemented")
+}
+func (UnimplementedCinitServer) Logs(*LogsRequest, Cinit_LogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Logs not implemented")
+}
+func (UnimplementedCinitServer) Events(*EventsRequest, Cinit_EventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedCinitServer) mustEmbedUnimplementedCinitServer() {}
+
+// UnsafeCinitServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CinitServer will
+// result in compilation errors.
+type UnsafeCinitServer interface {
+	mustEmbedUnimplementedCinitServer()
+}
+
+func RegisterCinitServer(s grpc.ServiceRegistrar, srv CinitServer) {
+	s.RegisterService(&Cinit_ServiceDesc, srv)
+}
+
+func _Cinit_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Status(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Start_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Start(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Stop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Stop(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Restart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Restart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Restart_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Restart(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Reload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Reload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Reload(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Delete(ctx, req.(*ServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Signal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Signal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Signal_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Signal(ctx, req.(*SignalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Scale_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScaleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CinitServer).Scale(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cinit_Scale_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CinitServer).Scale(ctx, req.(*ScaleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cinit_Logs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CinitServer).Logs(m, &cinitLogsServer{stream})
+}
+
+type Cinit_LogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type cinitLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *cinitLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cinit_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CinitServer).Events(m, &cinitEventsServer{stream})
+}
+
+type Cinit_EventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type cinitEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *cinitEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Cinit_ServiceDesc is the grpc.ServiceDesc for Cinit service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cinit_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cinit.v1.Cinit",
+	HandlerType: (*CinitServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Cinit_Register_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Cinit_List_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Cinit_Status_Handler,
+		},
+		{
+			MethodName: "Start",
+			Handler:    _Cinit_Start_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _Cinit_Stop_Handler,
+		},
+		{
+			MethodName: "Restart",
+			Handler:    _Cinit_Restart_Handler,
+		},
+		{
+			MethodName: "Reload",
+			Handler:    _Cinit_Reload_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Cinit_Delete_Handler,
+		},
+		{
+			MethodName: "Signal",
+			Handler:    _Cinit_Signal_Handler,
+		},
+		{
+			MethodName: "Scale",
+			Handler:    _Cinit_Scale_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Logs",
+			Handler:       _Cinit_Logs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Events",
+			Handler:       _Cinit_Events_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cinit.proto",
+}
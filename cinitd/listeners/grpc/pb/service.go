@@ -0,0 +1,233 @@
+package pb
+
+import (
+	"fmt"
+
+	"github.com/ulfox/cinit/cinitd/models"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// FromModel converts the definition of a service model to a Service message. The
+// parameters of the service actions are not part of a definition and are dropped
+func FromModel(s models.Service) *Service {
+	m := &Service{
+		Name:                s.Name,
+		Source:              s.Source,
+		Command:             s.Command,
+		Args:                s.Args,
+		Shell:               s.Shell,
+		Env:                 s.Env,
+		EnvFile:             s.EnvFile,
+		CleanEnv:            s.CleanEnv,
+		User:                s.User,
+		Group:               s.Group,
+		SupplementaryGroups: s.SupplementaryGroups,
+		WorkingDir:          s.WorkingDir,
+		Restart:             s.Restart,
+		DependsOn:           s.DependsOn,
+		ServiceType:         s.ServiceType,
+		SuccessExitCodes:    int32s(s.SuccessExitCodes),
+		AbortOnFailure:      s.AbortOnFailure,
+		Schedule:            s.Schedule,
+		Overlap:             s.Overlap,
+		Jitter:              duration(s.Jitter),
+		RunHistory:          int32(s.RunHistory),
+		Limits:              s.Limits,
+		CpuAffinity:         int32s(s.CPUAffinity),
+		StopSignal:          s.StopSignal,
+		StopTimeout:         duration(s.StopTimeout),
+		SignalProcessGroup:  s.SignalProcessGroup,
+		ReloadSignal:        s.ReloadSignal,
+		ReloadCommand:       s.ReloadCommand,
+		LogTarget:           s.LogTarget,
+		Replicas:            int32(s.Replicas),
+	}
+	if s.Nice != nil {
+		nice := int32(*s.Nice)
+		m.Nice = &nice
+	}
+	if s.OOMScoreAdj != nil {
+		adj := int32(*s.OOMScoreAdj)
+		m.OomScoreAdj = &adj
+	}
+
+	if b := s.Backoff; b != nil {
+		m.Backoff = &Backoff{
+			Delay:       duration(b.Delay),
+			MaxDelay:    duration(b.MaxDelay),
+			MaxRestarts: int32(b.MaxRestarts),
+			Window:      duration(b.Window),
+		}
+	}
+
+	if hc := s.HealthCheck; hc != nil {
+		m.HealthCheck = &HealthCheck{
+			Exec:         hc.Exec,
+			Tcp:          hc.TCP,
+			Interval:     duration(hc.Interval),
+			Timeout:      duration(hc.Timeout),
+			Retries:      int32(hc.Retries),
+			StartPeriod:  duration(hc.StartPeriod),
+			RestartAfter: int32(hc.RestartAfter),
+		}
+		if hc.HTTP != nil {
+			m.HealthCheck.Http = &HTTPCheck{
+				Url:    hc.HTTP.URL,
+				Status: int32(hc.HTTP.Status),
+			}
+		}
+	}
+
+	if r := s.Resources; r != nil {
+		m.Resources = &Resources{
+			MemoryMax: r.MemoryMax,
+			CpuMax:    r.CPUMax,
+			PidsMax:   r.PidsMax,
+			IoWeight:  int32(r.IOWeight),
+		}
+	}
+
+	if lr := s.LogRotation; lr != nil {
+		m.LogRotation = &LogRotation{
+			MaxSize:  lr.MaxSize,
+			MaxAge:   duration(lr.MaxAge),
+			MaxFiles: int32(lr.MaxFiles),
+			Compress: lr.Compress,
+		}
+	}
+
+	return m
+}
+
+// Model converts a Service message to the service model used by cinitd. It fails on
+// invalid durations, the rest of the definition is validated by the ServiceOperator
+func (m *Service) Model() (models.Service, error) {
+	var err error
+	d := func(field string, v *durationpb.Duration) models.Duration {
+		if v == nil || err != nil {
+			return 0
+		}
+		if e := v.CheckValid(); e != nil {
+			err = fmt.Errorf("%s: %s", field, e)
+			return 0
+		}
+		return models.Duration(v.AsDuration())
+	}
+
+	s := models.Service{
+		Name:                m.GetName(),
+		Source:              m.GetSource(),
+		Command:             m.GetCommand(),
+		Args:                m.GetArgs(),
+		Shell:               m.GetShell(),
+		Env:                 m.GetEnv(),
+		EnvFile:             m.GetEnvFile(),
+		CleanEnv:            m.GetCleanEnv(),
+		User:                m.GetUser(),
+		Group:               m.GetGroup(),
+		SupplementaryGroups: m.GetSupplementaryGroups(),
+		WorkingDir:          m.GetWorkingDir(),
+		Restart:             m.GetRestart(),
+		DependsOn:           m.GetDependsOn(),
+		ServiceType:         m.GetServiceType(),
+		SuccessExitCodes:    ints(m.GetSuccessExitCodes()),
+		AbortOnFailure:      m.GetAbortOnFailure(),
+		Schedule:            m.GetSchedule(),
+		Overlap:             m.GetOverlap(),
+		Jitter:              d("jitter", m.GetJitter()),
+		RunHistory:          int(m.GetRunHistory()),
+		Limits:              m.GetLimits(),
+		CPUAffinity:         ints(m.GetCpuAffinity()),
+		StopSignal:          m.GetStopSignal(),
+		StopTimeout:         d("stopTimeout", m.GetStopTimeout()),
+		SignalProcessGroup:  m.GetSignalProcessGroup(),
+		ReloadSignal:        m.GetReloadSignal(),
+		ReloadCommand:       m.GetReloadCommand(),
+		LogTarget:           m.GetLogTarget(),
+		Replicas:            int(m.GetReplicas()),
+	}
+	if m.Nice != nil {
+		nice := int(m.GetNice())
+		s.Nice = &nice
+	}
+	if m.OomScoreAdj != nil {
+		adj := int(m.GetOomScoreAdj())
+		s.OOMScoreAdj = &adj
+	}
+
+	if b := m.GetBackoff(); b != nil {
+		s.Backoff = &models.Backoff{
+			Delay:       d("backoff.delay", b.GetDelay()),
+			MaxDelay:    d("backoff.maxDelay", b.GetMaxDelay()),
+			MaxRestarts: int(b.GetMaxRestarts()),
+			Window:      d("backoff.window", b.GetWindow()),
+		}
+	}
+
+	if hc := m.GetHealthCheck(); hc != nil {
+		s.HealthCheck = &models.HealthCheck{
+			Exec:         hc.GetExec(),
+			TCP:          hc.GetTcp(),
+			Interval:     d("healthCheck.interval", hc.GetInterval()),
+			Timeout:      d("healthCheck.timeout", hc.GetTimeout()),
+			Retries:      int(hc.GetRetries()),
+			StartPeriod:  d("healthCheck.startPeriod", hc.GetStartPeriod()),
+			RestartAfter: int(hc.GetRestartAfter()),
+		}
+		if h := hc.GetHttp(); h != nil {
+			s.HealthCheck.HTTP = &models.HTTPCheck{
+				URL:    h.GetUrl(),
+				Status: int(h.GetStatus()),
+			}
+		}
+	}
+
+	if r := m.GetResources(); r != nil {
+		s.Resources = &models.Resources{
+			MemoryMax: r.GetMemoryMax(),
+			CPUMax:    r.GetCpuMax(),
+			PidsMax:   r.GetPidsMax(),
+			IOWeight:  int(r.GetIoWeight()),
+		}
+	}
+
+	if lr := m.GetLogRotation(); lr != nil {
+		s.LogRotation = &models.LogRotation{
+			MaxSize:  lr.GetMaxSize(),
+			MaxAge:   d("logRotation.maxAge", lr.GetMaxAge()),
+			MaxFiles: int(lr.GetMaxFiles()),
+			Compress: lr.Compress,
+		}
+	}
+
+	return s, err
+}
+
+func duration(d models.Duration) *durationpb.Duration {
+	if d == 0 {
+		return nil
+	}
+	return durationpb.New(d.D())
+}
+
+func int32s(v []int) []int32 {
+	if v == nil {
+		return nil
+	}
+	out := make([]int32, 0, len(v))
+	for _, i := range v {
+		out = append(out, int32(i))
+	}
+	return out
+}
+
+func ints(v []int32) []int {
+	if v == nil {
+		return nil
+	}
+	out := make([]int, 0, len(v))
+	for _, i := range v {
+		out = append(out, int(i))
+	}
+	return out
+}
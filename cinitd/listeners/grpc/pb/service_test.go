@@ -0,0 +1,111 @@
+package pb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestServiceRoundTrip(t *testing.T) {
+	nice, adj, compress := 5, -100, false
+	service := models.Service{
+		Name:                "web",
+		Source:              "/etc/cinit/web.yaml",
+		Command:             "/usr/local/bin/web",
+		Args:                []string{"--port", "8080"},
+		Shell:               true,
+		Env:                 map[string]string{"MODE": "prod"},
+		EnvFile:             []string{"/etc/web.env"},
+		CleanEnv:            true,
+		User:                "web",
+		Group:               "web",
+		SupplementaryGroups: []string{"log"},
+		WorkingDir:          "/srv/web",
+		Restart:             "on-failure",
+		Backoff: &models.Backoff{
+			Delay:       models.Duration(time.Second),
+			MaxDelay:    models.Duration(time.Minute),
+			MaxRestarts: 5,
+			Window:      models.Duration(10 * time.Minute),
+		},
+		DependsOn: []string{"db"},
+		HealthCheck: &models.HealthCheck{
+			HTTP:         &models.HTTPCheck{URL: "http://localhost:8080/health", Status: 204},
+			Interval:     models.Duration(10 * time.Second),
+			Timeout:      models.Duration(2 * time.Second),
+			Retries:      3,
+			StartPeriod:  models.Duration(30 * time.Second),
+			RestartAfter: 5,
+		},
+		ServiceType:      "oneshot",
+		SuccessExitCodes: []int{0, 3},
+		AbortOnFailure:   true,
+		Schedule:         "@every 5m",
+		Overlap:          "queue",
+		Jitter:           models.Duration(1500 * time.Millisecond),
+		RunHistory:       20,
+		Resources: &models.Resources{
+			MemoryMax: "512M",
+			CPUMax:    "50000 100000",
+			PidsMax:   128,
+			IOWeight:  200,
+		},
+		Limits:             map[string]string{"nofile": "1024:4096"},
+		Nice:               &nice,
+		OOMScoreAdj:        &adj,
+		CPUAffinity:        []int{0, 2},
+		StopSignal:         "SIGINT",
+		StopTimeout:        models.Duration(20 * time.Second),
+		SignalProcessGroup: true,
+		ReloadSignal:       "SIGHUP",
+		ReloadCommand:      []string{"/usr/local/bin/web", "reload"},
+		LogRotation: &models.LogRotation{
+			MaxSize:  "10M",
+			MaxAge:   models.Duration(24 * time.Hour),
+			MaxFiles: 7,
+			Compress: &compress,
+		},
+		LogTarget: "both",
+		Replicas:  3,
+	}
+
+	data, err := proto.Marshal(&RegisterRequest{Service: FromModel(service)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req RegisterRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := req.Service.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, service) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, service)
+	}
+
+	// Unset optional fields stay unset
+	got, err = FromModel(models.Service{Name: "web", Command: "web"}).Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Nice != nil || got.OOMScoreAdj != nil || got.Backoff != nil || got.HealthCheck != nil {
+		t.Errorf("unset fields are set: %+v", got)
+	}
+}
+
+func TestServiceModelInvalidDuration(t *testing.T) {
+	m := &Service{
+		Name:    "web",
+		Command: "web",
+		Backoff: &Backoff{Delay: &durationpb.Duration{Seconds: 1, Nanos: -1}},
+	}
+	if _, err := m.Model(); err == nil {
+		t.Error("no error for an invalid duration")
+	}
+}
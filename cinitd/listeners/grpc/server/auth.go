@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestName returns the service name of a request, if it has one
+func requestName(req interface{}) string {
+	switch req := req.(type) {
+	case *pb.RegisterRequest:
+		return req.GetService().GetName()
+	case interface{ GetName() string }:
+		return req.GetName()
+	}
+	return ""
+}
+
+// check returns an Unauthenticated or PermissionDenied error if the bearer token in the
+// metadata of ctx can not run the action of method. Rejected calls are logged
+func (s *Server) check(ctx context.Context, method string, req interface{}) error {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			token = auth.BearerToken(v[0])
+		}
+	}
+
+	action := methodAction(method)
+	t, err := s.auth.Authorize(token, action)
+	if err == nil {
+		return nil
+	}
+
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	s.logger.WithFields(logrus.Fields{
+		"Component": "gRPC Server",
+		"Part":      "Auth",
+		"Action":    action,
+		"Name":      requestName(req),
+		"Token":     t.Name,
+		"Remote":    remote,
+	}).Warnf("Request rejected: %s", err)
+
+	if err == auth.ErrForbidden {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+// authorizeUnary rejects calls that the bearer token of the caller may not make
+func (s *Server) authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !s.auth.Enabled() {
+		return handler(ctx, req)
+	}
+	if err := s.check(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream checks the first message of a stream, so that rejected streams are logged
+// with the service they asked for
+type authStream struct {
+	grpc.ServerStream
+	server  *Server
+	method  string
+	checked bool
+}
+
+func (a *authStream) RecvMsg(m interface{}) error {
+	if err := a.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if a.checked {
+		return nil
+	}
+	a.checked = true
+	return a.server.check(a.Context(), a.method, m)
+}
+
+// authorizeStream rejects streams that the bearer token of the caller may not open
+func (s *Server) authorizeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !s.auth.Enabled() {
+		return handler(srv, ss)
+	}
+	return handler(srv, &authStream{
+		ServerStream: ss,
+		server:       s,
+		method:       info.FullMethod,
+	})
+}
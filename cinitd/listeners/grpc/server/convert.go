@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"github.com/ulfox/cinit/cinitd/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// actionReply is a service action as replied by the ServiceOperator. The error of the
+// action is encoded as whatever JSON its type produces, so it is kept raw
+type actionReply struct {
+	models.ServiceAction
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// errorText returns the text of a raw JSON error. Strings are unquoted, other values
+// are returned compacted
+func errorText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+// serviceStatus converts the reply of a service action
+func serviceStatus(sa actionReply) *pb.ServiceStatus {
+	si := &pb.ServiceStatus{
+		Action:      sa.T,
+		Name:        sa.Name,
+		Pid:         sa.PID,
+		Status:      sa.Status,
+		StartTime:   timestamp(sa.StartTime),
+		ExitTime:    timestamp(sa.ExitTime),
+		Error:       errorText(sa.Error),
+		ExitStatus:  sa.ExitStatus,
+		Restarts:    int32(sa.Restarts),
+		NextRestart: timestamp(sa.NextRestart),
+		Health:      sa.Health,
+		NextRun:     timestamp(sa.NextRun),
+		StopResult:  sa.StopResult,
+		Signal:      sa.Signal,
+		SignalGroup: sa.SignalGroup,
+		Message:     sa.Message,
+		Argv:        sa.Argv,
+		Replicas:    int32(sa.Replicas),
+	}
+
+	for _, j := range sa.RestartHistory {
+		si.RestartHistory = append(si.RestartHistory, &pb.RestartRecord{
+			Time:   timestamppb.New(j.Time),
+			Reason: j.Reason,
+		})
+	}
+
+	for _, j := range sa.Runs {
+		si.Runs = append(si.Runs, &pb.RunRecord{
+			Start:      timestamppb.New(j.Start),
+			End:        timestamppb.New(j.End),
+			ExitStatus: j.ExitStatus,
+			ExitCode:   int32(j.ExitCode),
+		})
+	}
+
+	if u := sa.Usage; u != nil {
+		si.Usage = &pb.ResourceUsage{
+			Memory:  u.Memory,
+			CpuTime: int64(u.CPUTime),
+			Pids:    u.Pids,
+		}
+	}
+
+	for _, j := range sa.Instances {
+		si.Instances = append(si.Instances, &pb.ReplicaStatus{
+			Index:      int32(j.Index),
+			Puid:       j.PUID,
+			Pid:        j.PID,
+			Status:     j.Status,
+			Health:     j.Health,
+			StartTime:  timestamp(j.StartTime),
+			ExitTime:   timestamp(j.ExitTime),
+			ExitStatus: j.ExitStatus,
+			Restarts:   int32(j.Restarts),
+		})
+	}
+
+	return si
+}
+
+// eventMessage converts an event of the event bus
+func eventMessage(e events.Event) *pb.Event {
+	m := &pb.Event{
+		Seq:        e.Seq,
+		Boot:       e.Boot,
+		Time:       timestamppb.New(e.Time),
+		Type:       e.Type,
+		Name:       e.Name,
+		Instance:   e.Instance,
+		Puid:       e.PUID,
+		Pid:        int32(e.PID),
+		ExitStatus: e.ExitStatus,
+		Health:     e.Health,
+		Reason:     e.Reason,
+	}
+	if e.ExitCode != nil {
+		code := int32(*e.ExitCode)
+		m.ExitCode = &code
+	}
+	return m
+}
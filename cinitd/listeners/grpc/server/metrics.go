@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// methodAction returns the action of a gRPC method, /cinit.v1.Cinit/Status is status
+func methodAction(method string) string {
+	return strings.ToLower(method[strings.LastIndexByte(method, '/')+1:])
+}
+
+// instrumentUnary counts the calls and records how long they took
+func (s *Server) instrumentUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	action := methodAction(info.FullMethod)
+	s.metrics.CountRequest("grpc", action, status.Code(err).String())
+	s.metrics.ObserveLatency("grpc", action, time.Since(start))
+	return resp, err
+}
+
+// instrumentStream counts the streams. Their duration is not recorded
+func (s *Server) instrumentStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	s.metrics.CountRequest("grpc", methodAction(info.FullMethod), status.Code(err).String())
+	return err
+}
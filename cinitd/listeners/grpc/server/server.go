@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/metrics"
+	"google.golang.org/grpc"
+)
+
+// Server for managing the gRPC listening service
+type Server struct {
+	sync.Mutex
+	logger     *logrus.Logger
+	ctx        context.Context
+	wg         *sync.WaitGroup
+	service    *Service
+	metrics    *metrics.Registry
+	auth       *auth.Authenticator
+	unixSocket string
+	tcpAddr    string
+}
+
+// NewServerFactory for creating a new Server. The server listens on the unix socket s and,
+// if addr is not empty, on the TCP address addr
+func NewServerFactory(ctx context.Context, rcmd *channels.Remote, logManager *logs.Manager, eventBus *events.Bus, registry *metrics.Registry, authenticator *auth.Authenticator, s, addr string, l *logrus.Logger, wg *sync.WaitGroup) *Server {
+	return &Server{
+		logger:     l,
+		unixSocket: s,
+		tcpAddr:    addr,
+		ctx:        ctx,
+		wg:         wg,
+		service:    NewService(ctx, rcmd, logManager, eventBus, l),
+		metrics:    registry,
+		auth:       authenticator,
+	}
+}
+
+// ListenBackground for spawning the goroutines that serve gRPC calls until the context
+// of the server is canceled
+func (s *Server) ListenBackground() {
+	log := s.logger.WithFields(logrus.Fields{
+		"Component": "gRPC Server",
+		"Part":      "Init",
+	})
+	log.Info("Server initializing")
+
+	listeners := make([]net.Listener, 0, 2)
+
+	os.Remove(s.unixSocket)
+	listener, err := net.Listen("unix", s.unixSocket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listeners = append(listeners, listener)
+
+	if s.tcpAddr != "" {
+		listener, err := net.Listen("tcp", s.tcpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	server := s.newGRPCServer()
+
+	for _, j := range listeners {
+		s.wg.Add(1)
+		go func(wg *sync.WaitGroup, lis net.Listener) {
+			defer wg.Done()
+			if err := server.Serve(lis); err != nil {
+				log.Error(err)
+			}
+		}(s.wg, j)
+	}
+
+	s.wg.Add(1)
+	go func(ctx context.Context, wg *sync.WaitGroup, srv *grpc.Server) {
+		<-ctx.Done()
+		// Log streams end with the context of the server, so that they do not block
+		// the shutdown
+		srv.GracefulStop()
+		os.Remove(s.unixSocket)
+
+		wg.Done()
+		s.logger.WithFields(logrus.Fields{
+			"Component": "gRPC Server",
+		}).Info("Bye!")
+	}(s.ctx, s.wg, server)
+}
+
+// newGRPCServer returns a gRPC server with the Cinit service, whose calls are counted and
+// authorized by the interceptors of s
+func (s *Server) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.instrumentUnary, s.authorizeUnary),
+		grpc.ChainStreamInterceptor(s.instrumentStream, s.authorizeStream),
+	)
+	pb.RegisterCinitServer(server, s.service)
+	return server
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/processes"
+	"github.com/ulfox/cinit/cinitd/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient runs the ServiceOperator and the ProcessOperator of cinitd behind a gRPC
+// server on an in-memory listener and returns a client of it
+func newTestClient(t *testing.T) pb.CinitClient {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	logManager := logs.NewManager(t.TempDir(), nil, logs.TargetFile, nil)
+	eventBus := events.NewBus(100)
+	remoteChan := channels.NewRemoteChannel(5)
+	serviceChan := channels.NewServiceChannel(5, 5)
+
+	var soWG, poWG, serverWG sync.WaitGroup
+	soStop, poStop := make(chan bool), make(chan bool)
+	serviceOperator := services.NewProcessOperator(soStop, logger)
+	go serviceOperator.Init(remoteChan, serviceChan, &soWG)
+	serviceOperator.Ready()
+	processOperator := processes.NewProcessOperator(poStop, logger, false, serviceChan, logManager, nil, eventBus)
+	go processOperator.Init(&poWG)
+	processOperator.Ready()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewServerFactory(ctx, remoteChan, logManager, eventBus, nil, nil, "", "", logger, &serverWG)
+	server := s.newGRPCServer()
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		server.Stop()
+		soStop <- true
+		soWG.Wait()
+		poStop <- true
+		poWG.Wait()
+	})
+	return pb.NewCinitClient(conn)
+}
+
+func shellService(name, command string) *pb.Service {
+	return pb.FromModel(models.Service{Name: name, Command: command, Shell: true})
+}
+
+func TestService(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	reply, err := client.Register(ctx, &pb.RegisterRequest{Service: shellService("web", "echo hello; exec sleep 30")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message != "Service web has been registered" {
+		t.Errorf("register replied %q", reply.Message)
+	}
+	if _, err := client.Register(ctx, &pb.RegisterRequest{Service: shellService("web", "true")}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("registering web again returned %v", err)
+	}
+
+	var st *pb.ServiceStatus
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		st, err = client.Status(ctx, &pb.ServiceRequest{Name: "web"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Status == "running" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st.Status != "running" || st.Pid == "" || st.StartTime == nil {
+		t.Fatalf("web is %s with pid %q", st.Status, st.Pid)
+	}
+	if _, err := client.Status(ctx, &pb.ServiceRequest{Name: "db"}); status.Code(err) != codes.NotFound {
+		t.Errorf("status of a missing service returned %v", err)
+	}
+
+	var lines []string
+	for deadline := time.Now().Add(5 * time.Second); len(lines) == 0 && time.Now().Before(deadline); {
+		stream, err := client.Logs(ctx, &pb.LogsRequest{Name: "web", Tail: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			line, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, string(line.Line))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if strings.Join(lines, "") != "hello\n" {
+		t.Errorf("logs are %q", lines)
+	}
+
+	events, err := client.Events(ctx, &pb.EventsRequest{Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != "started" || e.Name != "web" || e.Seq != 1 || e.Boot == "" || st.Pid != fmt.Sprint(e.Pid) {
+		t.Errorf("got event %+v", e)
+	}
+
+	if st, err := client.Delete(ctx, &pb.ServiceRequest{Name: "web"}); err != nil || st.Status != "deleted" {
+		t.Fatalf("delete returned %+v, %v", st, err)
+	}
+	if e, err = events.Recv(); err != nil || e.Type != "exited" {
+		t.Errorf("got event %+v, %v after delete", e, err)
+	}
+	list, err := client.List(ctx, &pb.ListRequest{})
+	if err != nil || len(list.Services) != 0 {
+		t.Errorf("list returned %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Service implements the Cinit gRPC service on top of the remote command channel
+type Service struct {
+	pb.UnimplementedCinitServer
+	ctx    context.Context
+	rcmd   *channels.Remote
+	logs   *logs.Manager
+	events *events.Bus
+	logger *logrus.Logger
+}
+
+// NewService for creating a Service. Log and event streams end when ctx is done
+func NewService(ctx context.Context, rcmd *channels.Remote, logManager *logs.Manager, eventBus *events.Bus, l *logrus.Logger) *Service {
+	return &Service{
+		ctx:    ctx,
+		rcmd:   rcmd,
+		logs:   logManager,
+		events: eventBus,
+		logger: l,
+	}
+}
+
+// request sends a request to the ServiceOperator and returns its reply
+func (s *Service) request(service models.Service) ([]byte, error) {
+	body, err := json.Marshal(service)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	reply, err := s.rcmd.Request(body)
+	if err != nil && reply == nil {
+		s.logger.WithFields(logrus.Fields{
+			"Component": "gRPC Server",
+			"Name":      service.Name,
+		}).Error(err)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"Component": "gRPC Server",
+			"Name":      service.Name,
+		}).Error(err)
+	}
+	return reply, nil
+}
+
+// action runs a service action and converts its reply. Replies that are not a service
+// status are errors of the ServiceOperator
+func (s *Service) action(service models.Service) (*pb.ServiceStatus, error) {
+	if service.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "service name can not be empty")
+	}
+
+	reply, err := s.request(service)
+	if err != nil {
+		return nil, err
+	}
+
+	var sa actionReply
+	if err := json.Unmarshal(reply, &sa); err != nil {
+		return nil, replyError(reply)
+	}
+	return serviceStatus(sa), nil
+}
+
+// replyError converts an error reply of the ServiceOperator to a gRPC status
+func replyError(reply []byte) error {
+	msg := strings.TrimSpace(string(reply))
+	if strings.HasSuffix(msg, "does not exist") {
+		return status.Error(codes.NotFound, msg)
+	}
+	return status.Error(codes.FailedPrecondition, msg)
+}
+
+func (s *Service) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterReply, error) {
+	if req.Service == nil {
+		return nil, status.Error(codes.InvalidArgument, "service can not be empty")
+	}
+	service, err := req.Service.Model()
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "service: %s", err)
+	}
+	service.T = "register"
+
+	reply, err := s.request(service)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := string(reply)
+	if msg != "Service "+service.Name+" has been registered" {
+		return nil, replyError(reply)
+	}
+	return &pb.RegisterReply{Message: msg}, nil
+}
+
+func (s *Service) List(ctx context.Context, req *pb.ListRequest) (*pb.ListReply, error) {
+	reply, err := s.request(models.Service{T: "list", Name: "all"})
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct{ Services []string }
+	if err := json.Unmarshal(reply, &list); err != nil {
+		if string(reply) == "No services" {
+			return &pb.ListReply{}, nil
+		}
+		return nil, replyError(reply)
+	}
+	return &pb.ListReply{Services: list.Services}, nil
+}
+
+func (s *Service) Status(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "status", Name: req.Name})
+}
+
+func (s *Service) Start(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "start", Name: req.Name})
+}
+
+func (s *Service) Stop(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "stop", Name: req.Name})
+}
+
+func (s *Service) Restart(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "restart", Name: req.Name})
+}
+
+func (s *Service) Reload(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "reload", Name: req.Name})
+}
+
+func (s *Service) Delete(ctx context.Context, req *pb.ServiceRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{T: "delete", Name: req.Name})
+}
+
+func (s *Service) Signal(ctx context.Context, req *pb.SignalRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{
+		T:           "signal",
+		Name:        req.Name,
+		Signal:      req.Signal,
+		SignalGroup: req.Group,
+	})
+}
+
+func (s *Service) Scale(ctx context.Context, req *pb.ScaleRequest) (*pb.ServiceStatus, error) {
+	return s.action(models.Service{
+		T:        "scale",
+		Name:     req.Name,
+		Replicas: int(req.Replicas),
+	})
+}
+
+// lineSender sends every line written by the log manager as a LogLine
+type lineSender struct {
+	stream pb.Cinit_LogsServer
+}
+
+func (l *lineSender) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+	if err := l.stream.Send(&pb.LogLine{Line: line}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *Service) Logs(req *pb.LogsRequest, stream pb.Cinit_LogsServer) error {
+	log := s.logger.WithFields(logrus.Fields{
+		"Component": "gRPC Server",
+		"Part":      "Logs",
+		"Name":      req.Name,
+	})
+
+	if req.Tail < 0 {
+		return status.Error(codes.InvalidArgument, "tail must be a number of lines")
+	}
+	opts := logs.ReadOptions{
+		Stream: logs.Stdout,
+		Tail:   int(req.Tail),
+		Follow: req.Follow,
+	}
+	if req.Stderr {
+		opts.Stream = logs.Stderr
+	}
+	if req.Since != nil {
+		opts.Since = req.Since.AsTime()
+	}
+
+	si, err := s.action(models.Service{T: "status", Name: req.Name})
+	if err != nil {
+		return err
+	}
+
+	names := []string{req.Name}
+	if len(si.Instances) > 0 {
+		names = names[:0]
+		for _, j := range si.Instances {
+			names = append(names, fmt.Sprintf("%s-%d", req.Name, j.Index))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.logs.Stream(ctx, names, opts, &lineSender{stream: stream}); err != nil {
+		log.Debugf("Log stream ended: %s", err)
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return nil
+}
+
+func (s *Service) Events(req *pb.EventsRequest, stream pb.Cinit_EventsServer) error {
+	replay, sub := s.events.Subscribe(req.After, req.Boot, req.Name)
+	defer sub.Close()
+
+	for _, e := range replay {
+		if err := stream.Send(eventMessage(e)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "event stream fell behind, resume from the last sequence number")
+			}
+			if err := stream.Send(eventMessage(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
+	e "github.com/ulfox/cinit/cinitd/errors"
+)
+
+// maxRequestBody limits the body of requests to /api/services, which is read before the
+// request is authorized
+const maxRequestBody = 1 << 20
+
+// apiActions are the request types of /api/services. Other types are reported as unknown,
+// so that clients can not add label values to the metrics of cinitd
+var apiActions = map[string]bool{
+	"register": true,
+	"list":     true,
+	"status":   true,
+	"delete":   true,
+	"stop":     true,
+	"start":    true,
+	"restart":  true,
+	"reload":   true,
+	"signal":   true,
+	"scale":    true,
+	"logs":     true,
+}
+
+// peekRequest returns the action and the service name of an API request, and whether it
+// is a stream. The action of a request to /api/services is its type, which is read from
+// the body without consuming it. An error is returned if the body is larger than
+// maxRequestBody
+func peekRequest(w http.ResponseWriter, r *http.Request) (action, name string, stream bool, err error) {
+	template, _ := mux.CurrentRoute(r).GetPathTemplate()
+	switch template {
+	case "/api/services":
+		action = "unknown"
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		r.Body.Close()
+		if err != nil {
+			return action, "", false, err
+		}
+		var req struct {
+			T    string `json:"type"`
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(body, &req) == nil && apiActions[req.T] {
+			action, name = req.T, req.Name
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	case "/api/services/{name}/logs":
+		action, name, stream = "logs", mux.Vars(r)["name"], true
+	case "/api/events":
+		action, name, stream = "events", r.URL.Query().Get("name"), true
+	default:
+		action = "metrics"
+	}
+	return action, name, stream, nil
+}
+
+// authorize rejects requests whose bearer token is missing, unknown or has a role that
+// can not run the action of the request
+func (s *Service) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.auth.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action, name, _, err := peekRequest(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		token, err := s.auth.Authorize(auth.BearerToken(r.Header.Get("Authorization")), action)
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"Component": "Router",
+			"Part":      "Auth",
+			"Action":    action,
+			"Name":      name,
+			"Token":     token.Name,
+			"Remote":    r.RemoteAddr,
+		}).Warnf("Request rejected: %s", err)
+
+		if err == auth.ErrForbidden {
+			e.ForbiddenError(w)
+			return
+		}
+		e.UnauthorizedError(w)
+	})
+}
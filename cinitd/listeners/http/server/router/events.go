@@ -0,0 +1,107 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/events"
+)
+
+// eventKeepAlive is how often a comment is sent on an idle event stream
+const eventKeepAlive = 15 * time.Second
+
+// serviceEvents streams the events of the services as Server-Sent Events. The id of
+// every event is its boot ID and sequence number, as <boot>:<seq>. Clients resume with
+// the Last-Event-ID header or the after and boot queries, name limits the events to a
+// service
+func (s *Service) serviceEvents(w http.ResponseWriter, r *http.Request) {
+	log := s.logger.WithFields(logrus.Fields{
+		"Component": "Router",
+		"Part":      "Events",
+	})
+
+	after, boot, err := eventsAfter(r)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(500)
+		w.Write([]byte("streaming is not supported"))
+		return
+	}
+
+	replay, sub := s.events.Subscribe(after, boot, r.URL.Query().Get("name"))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	for _, e := range replay {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				log.Debug("Event subscriber fell behind, closing its stream")
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// eventsAfter returns the sequence number and the boot ID a client resumes from. The
+// Last-Event-ID header holds both, the after query only a sequence number
+func eventsAfter(r *http.Request) (uint64, string, error) {
+	v, boot := r.Header.Get("Last-Event-ID"), ""
+	if v != "" {
+		if i := strings.LastIndexByte(v, ':'); i >= 0 {
+			v, boot = v[i+1:], v[:i]
+		}
+	} else {
+		v, boot = r.URL.Query().Get("after"), r.URL.Query().Get("boot")
+	}
+	if v == "" {
+		return 0, boot, nil
+	}
+	after, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("after must be a sequence number")
+	}
+	return after, boot, nil
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s:%d\nevent: %s\ndata: %s\n\n", e.Boot, e.Seq, e.Type, data)
+	return err
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ulfox/cinit/cinitd/events"
+)
+
+func TestEventsAfter(t *testing.T) {
+	tests := []struct {
+		query, lastEventID string
+		after              uint64
+		boot               string
+		err                bool
+	}{
+		{},
+		{query: "after=7", after: 7},
+		{query: "after=7&boot=b1", after: 7, boot: "b1"},
+		{lastEventID: "b1:7", after: 7, boot: "b1"},
+		{lastEventID: "7", after: 7},
+		// Last-Event-ID wins over the query
+		{query: "after=3&boot=b0", lastEventID: "b1:7", after: 7, boot: "b1"},
+		{query: "after=x", err: true},
+		{lastEventID: "b1:x", err: true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/events?"+tt.query, nil)
+		if tt.lastEventID != "" {
+			r.Header.Set("Last-Event-ID", tt.lastEventID)
+		}
+		after, boot, err := eventsAfter(r)
+		if (err != nil) != tt.err {
+			t.Errorf("%q, %q: error = %v, want error %v", tt.query, tt.lastEventID, err, tt.err)
+			continue
+		}
+		if after != tt.after || boot != tt.boot {
+			t.Errorf("%q, %q: got %d, %q, want %d, %q", tt.query, tt.lastEventID, after, boot, tt.after, tt.boot)
+		}
+	}
+}
+
+func TestWriteEventID(t *testing.T) {
+	b := events.NewBus(1)
+	b.Publish(events.Event{Type: events.Started, Name: "web"})
+	replay, sub := b.Subscribe(0, "", "")
+	sub.Close()
+
+	w := httptest.NewRecorder()
+	if err := writeEvent(w, replay[0]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id: " + b.Boot() + ":1\nevent: started\n"; !strings.HasPrefix(w.Body.String(), want) {
+		t.Errorf("got %q, want it to start with %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// flushWriter sends every write to the client right away
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
+
+// serviceLogs streams the output of a service, or of all its replicas. The query
+// selects the output: stream (stdout or stderr), tail, since (RFC 3339 time or a
+// duration before now) and follow
+func (s *Service) serviceLogs(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	log := s.logger.WithFields(logrus.Fields{
+		"Component": "Router",
+		"Part":      "Logs",
+		"Name":      name,
+	})
+
+	opts, err := logOptions(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	body, err := json.Marshal(models.Service{T: "status", Name: name})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	reply, err := s.request(body)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	var status models.ServiceAction
+	if err := json.Unmarshal(reply, &status); err != nil {
+		w.WriteHeader(404)
+		w.Write(reply)
+		return
+	}
+
+	names := []string{name}
+	if len(status.Instances) > 0 {
+		names = names[:0]
+		for _, j := range status.Instances {
+			names = append(names, fmt.Sprintf("%s-%d", name, j.Index))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	if err := s.logs.Stream(r.Context(), names, opts, &flushWriter{w: w}); err != nil {
+		log.Debugf("Log stream ended: %s", err)
+	}
+}
+
+func logOptions(query url.Values) (logs.ReadOptions, error) {
+	opts := logs.ReadOptions{
+		Stream: logs.Stdout,
+	}
+
+	switch query.Get("stream") {
+	case "", "stdout":
+	case "stderr":
+		opts.Stream = logs.Stderr
+	default:
+		return opts, fmt.Errorf("stream must be stdout or stderr")
+	}
+
+	if v := query.Get("tail"); v != "" {
+		tail, err := strconv.Atoi(v)
+		if err != nil || tail < 0 {
+			return opts, fmt.Errorf("tail must be a number of lines")
+		}
+		opts.Tail = tail
+	}
+
+	if v := query.Get("since"); v != "" {
+		since, err := parseSince(v, time.Now())
+		if err != nil {
+			return opts, err
+		}
+		opts.Since = since
+	}
+
+	if v := query.Get("follow"); v != "" {
+		follow, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("follow must be true or false")
+		}
+		opts.Follow = follow
+	}
+
+	return opts, nil
+}
+
+// parseSince parses an RFC 3339 time, or a duration that is subtracted from now
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("since must be an RFC 3339 time or a duration")
+	}
+	return t, nil
+}
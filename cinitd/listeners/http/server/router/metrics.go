@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/metrics"
+)
+
+// statusRecorder keeps the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// instrument counts the API requests and records how long they took. The action of a
+// request to /api/services is its type, or unknown if the type is not an action of the
+// API. Log and event streams are counted only
+func (s *Service) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &statusRecorder{ResponseWriter: w, code: 200}
+		action, _, stream, err := peekRequest(rec, r)
+		if err != nil {
+			rec.WriteHeader(http.StatusRequestEntityTooLarge)
+			rec.Write([]byte(err.Error()))
+		} else {
+			next.ServeHTTP(rec, r)
+		}
+
+		s.metrics.CountRequest("http", action, strconv.Itoa(rec.code))
+		if !stream {
+			s.metrics.ObserveLatency("http", action, time.Since(start))
+		}
+	})
+}
+
+// serveMetrics writes the metrics of cinitd in the Prometheus text format
+func (s *Service) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metrics == nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := s.metrics.Write(w); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"Component": "Router",
+			"Part":      "Metrics",
+		}).Error(err)
+	}
+}
@@ -1,35 +1,49 @@
 package router
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net/http"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
 	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/metrics"
 )
 
 // Service for creating a new http router
 type Service struct {
-	Router *mux.Router
-	rcmd   *channels.Remote
-	logger *logrus.Logger
+	Router  *mux.Router
+	rcmd    *channels.Remote
+	logs    *logs.Manager
+	events  *events.Bus
+	metrics *metrics.Registry
+	auth    *auth.Authenticator
+	logger  *logrus.Logger
 }
 
 // UpdateRoutes method updates main route with our Handle Functions
 func (s *Service) UpdateRoutes() *Service {
 	s.Router.HandleFunc("/api/services", s.services).Methods("POST")
+	s.Router.HandleFunc("/api/services/{name}/logs", s.serviceLogs).Methods("GET")
+	s.Router.HandleFunc("/api/events", s.serviceEvents).Methods("GET")
+	s.Router.HandleFunc("/metrics", s.serveMetrics).Methods("GET")
+	s.Router.Use(s.instrument, s.authorize)
 	return s
 }
 
 // NewRouter factory for creating a Service router
-func NewRouter(rcmd *channels.Remote, l *logrus.Logger) *Service {
+func NewRouter(rcmd *channels.Remote, logManager *logs.Manager, eventBus *events.Bus, registry *metrics.Registry, authenticator *auth.Authenticator, l *logrus.Logger) *Service {
 	return &Service{
-		Router: mux.NewRouter().StrictSlash(true),
-		rcmd:   rcmd,
-		logger: l,
+		Router:  mux.NewRouter().StrictSlash(true),
+		rcmd:    rcmd,
+		logs:    logManager,
+		events:  eventBus,
+		metrics: registry,
+		auth:    authenticator,
+		logger:  l,
 	}
 }
 
@@ -48,54 +62,34 @@ func (s *Service) services(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rChan := make(chan []byte)
-
-	s.rcmd.Push(rChan)
-	reply := <-rChan
-	if string(reply) != "0x0" {
-		log.Errorf("rChan init was not 0x0")
+	reply, err := s.request(body)
+	if err != nil {
+		log.Error(err)
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(500)
-		w.Write([]byte("Internal server error"))
+		if _, err := w.Write([]byte(err.Error())); err != nil {
+			log.Error(err)
+		}
+		return
 	}
 
-	rChan <- body
-
-rLoop:
-	for {
-		select {
-		case reply := <-rChan:
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(200)
-			_, err = w.Write(reply)
-			if err != nil {
-				log.Error(err)
-			}
-			break rLoop
-		case <-time.After(s.rcmd.DataTimeOut):
-			w.Header().Set("Content-Type", "application/json")
-			msg := fmt.Sprintf("Service channel did not respond within %d seconds. Closing connection", s.rcmd.DataTimeOut)
-			log.Errorf(msg)
-			w.WriteHeader(500)
-			_, err = w.Write([]byte(msg))
-			if err != nil {
-				log.Error(err)
-			}
-			return
-		}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_, err = w.Write(reply)
+	if err != nil {
+		log.Error(err)
 	}
+}
 
-	for {
-		select {
-		case reply := <-rChan:
-			if string(reply) != "0xF" {
-				msg := "server error, expected 0xF but received " + string(reply)
-				log.Errorf(msg)
-			}
-			return
-		case <-time.After(10 * time.Second):
-			msg := "Service channel did not respond within 10 seconds. Done waiting"
-			log.Errorf(msg)
-			return
-		}
+// request sends a request to the ServiceOperator over the remote command channel and
+// returns its reply
+func (s *Service) request(body []byte) ([]byte, error) {
+	reply, err := s.rcmd.Request(body)
+	if err != nil && reply != nil {
+		s.logger.WithFields(logrus.Fields{
+			"Component": "Router",
+		}).Error(err)
+		return reply, nil
 	}
+	return reply, err
 }
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/metrics"
+)
+
+type emptyPool struct{}
+
+func (emptyPool) PoolMetrics() metrics.Pool {
+	return metrics.Pool{}
+}
+
+func newTestRouter(t *testing.T) (*Service, *metrics.Registry) {
+	t.Helper()
+
+	authenticator, err := auth.NewAuthenticator([]auth.Token{
+		{Name: "view", Role: auth.RoleViewer, Token: "v1ew"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := metrics.NewRegistry(emptyPool{}, channels.NewRemoteChannel(1), channels.NewServiceChannel(1, 1))
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	return NewRouter(nil, nil, nil, registry, authenticator, logger).UpdateRoutes(), registry
+}
+
+func TestUnknownActionsShareOneLabel(t *testing.T) {
+	router, registry := newTestRouter(t)
+
+	for _, j := range []string{"junk1", "junk2", "junk3"} {
+		rec := httptest.NewRecorder()
+		router.Router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/services", strings.NewReader(`{"type":"`+j+`"}`)))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: got %d, want 401", j, rec.Code)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := registry.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "junk") {
+		t.Errorf("request types became label values:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `cinit_api_requests_total{listener="http",action="unknown",code="401"} 3`) {
+		t.Errorf("unknown requests are not counted together:\n%s", out.String())
+	}
+}
+
+func TestRequestBodyIsLimited(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	body := `{"type":"status","name":"` + strings.Repeat("a", maxRequestBody) + `"}`
+	rec := httptest.NewRecorder()
+	router.Router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/services", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want 413", rec.Code)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	router, _ := newTestRouter(t)
+	var log bytes.Buffer
+	router.logger.SetOutput(&log)
+
+	tests := []struct {
+		name, method, path, body, token string
+		code                            int
+		logged                          []string
+	}{
+		{
+			name: "no token", method: "POST", path: "/api/services", body: `{"type":"status","name":"web"}`,
+			code: http.StatusUnauthorized, logged: []string{"Action=status", "Name=web", `Token=`},
+		},
+		{
+			name: "unknown token", method: "POST", path: "/api/services", body: `{"type":"stop","name":"db"}`, token: "guess",
+			code: http.StatusUnauthorized, logged: []string{"Action=stop", "Name=db"},
+		},
+		{
+			name: "role too low", method: "POST", path: "/api/services", body: `{"type":"register","name":"web"}`, token: "v1ew",
+			code: http.StatusForbidden, logged: []string{"Action=register", "Name=web", "Token=view"},
+		},
+		{
+			name: "stream", method: "GET", path: "/api/services/web/logs",
+			code: http.StatusUnauthorized, logged: []string{"Action=logs", "Name=web"},
+		},
+		{name: "allowed", method: "GET", path: "/metrics", token: "v1ew", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		log.Reset()
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		router.Router.ServeHTTP(rec, r)
+
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if len(tt.logged) == 0 && log.Len() > 0 {
+			t.Errorf("%s: logged %q", tt.name, log.String())
+		}
+		for _, j := range tt.logged {
+			if !strings.Contains(log.String(), j) {
+				t.Errorf("%s: %q is not logged in %q", tt.name, j, log.String())
+			}
+		}
+		if strings.Contains(log.String(), "v1ew") {
+			t.Errorf("%s: the token is logged", tt.name)
+		}
+	}
+}
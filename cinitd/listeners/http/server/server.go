@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/auth"
 	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
 	"github.com/ulfox/cinit/cinitd/listeners/http/server/router"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/metrics"
 )
 
 // Server for managing a HTTP listening service
@@ -21,14 +26,14 @@ type Server struct {
 	port, listenAt string
 }
 
-func NewServerFactory(ctx context.Context, rcmd *channels.Remote, p, i string, l *logrus.Logger, wg *sync.WaitGroup) *Server {
+func NewServerFactory(ctx context.Context, rcmd *channels.Remote, logManager *logs.Manager, eventBus *events.Bus, registry *metrics.Registry, authenticator *auth.Authenticator, p, i string, l *logrus.Logger, wg *sync.WaitGroup) *Server {
 	return &Server{
 		logger:   l,
 		port:     p,
 		listenAt: i,
 		ctx:      ctx,
 		wg:       wg,
-		router:   router.NewRouter(rcmd, l).UpdateRoutes(),
+		router:   router.NewRouter(rcmd, logManager, eventBus, registry, authenticator, l).UpdateRoutes(),
 	}
 }
 
@@ -42,6 +47,10 @@ func (s *Server) ListenBackground() {
 	server := &http.Server{
 		Addr:    s.listenAt + ":" + s.port,
 		Handler: s.router.Router,
+		// Requests end with the server, so that followed logs do not block its shutdown
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
 	}
 
 	s.wg.Add(1)
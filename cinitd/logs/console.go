@@ -0,0 +1,146 @@
+package logs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	TargetFile    = "file"
+	TargetConsole = "console"
+	TargetBoth    = "both"
+
+	// maxLine is the longest partial line held back. Longer lines are written in parts
+	maxLine = 64 << 10
+)
+
+// Targets lists the supported values of a service log target
+func Targets() []string {
+	return []string{TargetFile, TargetConsole, TargetBoth}
+}
+
+// Console writes the output of services to the stdout and stderr of cinitd. Output is
+// written in whole lines prefixed with [name], and with a timestamp if enabled, so lines
+// of different services never interleave
+type Console struct {
+	sync.Mutex
+	stdout, stderr io.Writer
+	timestamps     bool
+}
+
+// NewConsole returns a Console writing to stdout and stderr
+func NewConsole(stdout, stderr io.Writer, timestamps bool) *Console {
+	return &Console{
+		stdout:     stdout,
+		stderr:     stderr,
+		timestamps: timestamps,
+	}
+}
+
+// consoleWriter holds back the partial last line of the output of a service until the
+// rest of it is written
+type consoleWriter struct {
+	console *Console
+	out     io.Writer
+	prefix  string
+	buf     []byte
+}
+
+func (c *Console) writer(name, stream string) *consoleWriter {
+	out := c.stdout
+	if stream == Stderr {
+		out = c.stderr
+	}
+	return &consoleWriter{
+		console: c,
+		out:     out,
+		prefix:  "[" + name + "] ",
+	}
+}
+
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	end := len(w.buf)
+	for end > 0 && w.buf[end-1] != '\n' {
+		end--
+	}
+	if end == 0 && len(w.buf) < maxLine {
+		return len(p), nil
+	}
+	if end == 0 {
+		end = len(w.buf)
+	}
+
+	err := w.write(w.buf[:end])
+	w.buf = append(w.buf[:0], w.buf[end:]...)
+	return len(p), err
+}
+
+// flush writes the held back partial line
+func (w *consoleWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// write prefixes every line of lines and writes them at once
+func (w *consoleWriter) write(lines []byte) error {
+	var prefix string
+	if w.console.timestamps {
+		prefix = time.Now().UTC().Format(time.RFC3339Nano) + " "
+	}
+	prefix += w.prefix
+
+	out := make([]byte, 0, len(lines)+len(prefix)*4)
+	start := 0
+	for i, b := range lines {
+		if b == '\n' {
+			out = append(out, prefix...)
+			out = append(out, lines[start:i+1]...)
+			start = i + 1
+		}
+	}
+	if start < len(lines) {
+		out = append(out, prefix...)
+		out = append(out, lines[start:]...)
+		out = append(out, '\n')
+	}
+
+	w.console.Lock()
+	defer w.console.Unlock()
+	_, err := w.out.Write(out)
+	return err
+}
+
+// Output is the destination of one stream of one run of a service. Close writes the
+// output held back for the console, the log file stays open for the next run
+type Output struct {
+	file    *Writer
+	console *consoleWriter
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	if o.file != nil {
+		if _, err := o.file.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	if o.console != nil {
+		if _, err := o.console.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (o *Output) Close() error {
+	if o.console != nil {
+		return o.console.flush()
+	}
+	return nil
+}
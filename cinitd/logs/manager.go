@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	Stdout = "out"
+	Stderr = "err"
+)
+
+// Manager owns the log files of the services under a directory. The writer of a log file
+// is shared by all runs of a service, so rotation keeps working across restarts
+type Manager struct {
+	sync.Mutex
+	dir      string
+	defaults *models.LogRotation
+	target   string
+	console  *Console
+	writers  map[string]*Writer
+}
+
+// NewManager returns a Manager for the log files under dir. defaults are the rotation
+// settings and target the log target of services that do not set their own
+func NewManager(dir string, defaults *models.LogRotation, target string, console *Console) *Manager {
+	return &Manager{
+		dir:      dir,
+		defaults: defaults,
+		target:   target,
+		console:  console,
+		writers:  make(map[string]*Writer),
+	}
+}
+
+// Path returns the path of a log file of a service. stream is Stdout or Stderr
+func (m *Manager) Path(name, stream string) string {
+	return filepath.Join(m.dir, fmt.Sprintf("%s-%s.log", name, stream))
+}
+
+// Writer returns the writer of a log file of a service, with the rotation settings of
+// the service applied
+func (m *Manager) Writer(name, stream string, rotation *models.LogRotation) (*Writer, error) {
+	r, err := Resolve(m.defaults, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	path := m.Path(name, stream)
+
+	m.Lock()
+	defer m.Unlock()
+	w := m.writers[path]
+	if w == nil {
+		w = NewWriter(path, r)
+		m.writers[path] = w
+		return w, nil
+	}
+	w.SetRotation(r)
+	return w, nil
+}
+
+// Output returns the destination of a stream of a service for its log target: the log
+// file, the console of cinitd or both
+func (m *Manager) Output(name, stream, target string, rotation *models.LogRotation) (*Output, error) {
+	if target == "" {
+		target = m.target
+	}
+
+	o := &Output{}
+	if target != TargetConsole {
+		w, err := m.Writer(name, stream, rotation)
+		if err != nil {
+			return nil, err
+		}
+		o.file = w
+	}
+	if target != TargetFile && m.console != nil {
+		o.console = m.console.writer(name, stream)
+	}
+	return o, nil
+}
+
+// Remove closes the log files of a deleted service. The files are kept
+func (m *Manager) Remove(name string) {
+	for _, stream := range []string{Stdout, Stderr} {
+		path := m.Path(name, stream)
+
+		m.Lock()
+		w := m.writers[path]
+		delete(m.writers, path)
+		m.Unlock()
+
+		if w != nil {
+			w.Close()
+		}
+	}
+}
+
+// Close closes all log files
+func (m *Manager) Close() {
+	m.Lock()
+	writers := m.writers
+	m.writers = make(map[string]*Writer)
+	m.Unlock()
+
+	for _, w := range writers {
+		w.Close()
+	}
+}
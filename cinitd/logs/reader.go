@@ -0,0 +1,390 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// followInterval is how often a followed log file is checked for new output
+const followInterval = 250 * time.Millisecond
+
+// ReadOptions select the output returned by Stream. Stream is Stdout or Stderr. Tail
+// limits the output to the last lines of every log, zero returns all of it. Only
+// output written at or after Since is returned, with a precision of one second for the
+// current log file. Rotated files are returned whole if they were written after Since
+type ReadOptions struct {
+	Stream string
+	Tail   int
+	Since  time.Time
+	Follow bool
+}
+
+// lineWriter writes whole lines to out, prefixed with the name of their service when
+// the output of several services is written
+type lineWriter struct {
+	sync.Mutex
+	out    io.Writer
+	prefix bool
+}
+
+func (lw *lineWriter) write(name string, line []byte) error {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	if lw.prefix {
+		line = append([]byte("["+name+"] "), line...)
+	}
+
+	lw.Lock()
+	defer lw.Unlock()
+	_, err := lw.out.Write(line)
+	return err
+}
+
+// Stream writes the output of the logs of services to out. With Follow set it keeps
+// writing new output, across rotations and restarts of the services, until ctx is done
+// or out fails. Lines of several services are prefixed with [name]
+func (m *Manager) Stream(ctx context.Context, names []string, opts ReadOptions, out io.Writer) error {
+	if opts.Stream == "" {
+		opts.Stream = Stdout
+	}
+	lw := &lineWriter{
+		out:    out,
+		prefix: len(names) > 1,
+	}
+
+	if !opts.Follow {
+		for _, name := range names {
+			if err := m.stream(ctx, name, opts, lw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := m.stream(ctx, name, opts, lw); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// stream writes the log of one service: the rotated files, the current file and, if
+// following, the output written to the current file and to the files replacing it
+func (m *Manager) stream(ctx context.Context, name string, opts ReadOptions, lw *lineWriter) error {
+	path := m.Path(name, opts.Stream)
+
+	m.Lock()
+	writer := m.writers[path]
+	m.Unlock()
+
+	tail := newTailBuffer(opts.Tail)
+	emit := func(line []byte) error {
+		if opts.Tail > 0 {
+			tail.add(line)
+			return nil
+		}
+		return lw.write(name, line)
+	}
+
+	// The current file is opened first, so that output written while the rotated files
+	// are read is not lost
+	current, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if current != nil {
+		defer func() {
+			current.Close()
+		}()
+	}
+
+	segments, err := Segments(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		info, err := os.Stat(s)
+		if err != nil {
+			continue
+		}
+		if !opts.Since.IsZero() && info.ModTime().Before(opts.Since) {
+			continue
+		}
+		if err := readSegment(s, emit); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	var pending []byte
+	if current != nil {
+		if err := seekSince(current, writer, opts.Since); err != nil {
+			return err
+		}
+		if pending, err = readLines(current, emit); err != nil {
+			return err
+		}
+	}
+
+	// Without following, the unfinished last line is the last line of the log
+	if !opts.Follow && len(pending) > 0 {
+		if err := emit(pending); err != nil {
+			return err
+		}
+	}
+
+	for _, line := range tail.lines() {
+		if err := lw.write(name, line); err != nil {
+			return err
+		}
+	}
+
+	if !opts.Follow {
+		return nil
+	}
+	return follow(ctx, path, current, pending, func(line []byte) error {
+		return lw.write(name, line)
+	})
+}
+
+// follow writes the lines appended to the log file at path. When the file is replaced by
+// a rotation the rest of the old file is read before switching to the new one
+func follow(ctx context.Context, path string, current *os.File, pending []byte, emit func([]byte) error) error {
+	defer func() {
+		if current != nil {
+			current.Close()
+		}
+	}()
+
+	for {
+		// Checked before reading, so that everything written to the old file is read
+		rotated := replaced(path, current)
+
+		if current != nil {
+			data, err := ioutil.ReadAll(current)
+			if err != nil {
+				return err
+			}
+			if pending, err = emitLines(append(pending, data...), emit); err != nil {
+				return err
+			}
+		}
+
+		if rotated {
+			if current != nil {
+				if len(pending) > 0 {
+					if err := emit(pending); err != nil {
+						return err
+					}
+					pending = nil
+				}
+				current.Close()
+				current = nil
+			}
+			if f, err := os.Open(path); err == nil {
+				current = f
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+// emitLines emits the whole lines of buf and returns the rest
+func emitLines(buf []byte, emit func([]byte) error) ([]byte, error) {
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return append([]byte(nil), buf...), nil
+		}
+		if err := emit(buf[:i+1]); err != nil {
+			return nil, err
+		}
+		buf = buf[i+1:]
+	}
+}
+
+// replaced reports whether path no longer is the file current has been opened from
+func replaced(path string, current *os.File) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if current == nil {
+		return true
+	}
+	opened, err := current.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(info, opened)
+}
+
+// seekSince moves to the first output of the current log file written at or after since.
+// Without marks for the file, it is read whole if it was modified after since and
+// skipped otherwise
+func seekSince(f *os.File, writer *Writer, since time.Time) error {
+	if since.IsZero() {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	offset := info.Size()
+	if writer != nil {
+		if o, ok := writer.sinceOffset(info, since); ok {
+			offset = o
+		} else if !info.ModTime().Before(since) {
+			offset = 0
+		}
+	} else if !info.ModTime().Before(since) {
+		offset = 0
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if offset == 0 {
+		return nil
+	}
+
+	// Marks point at writes, which may start in the middle of a line
+	prev := make([]byte, 1)
+	if _, err := f.ReadAt(prev, offset-1); err != nil || prev[0] == '\n' {
+		return nil
+	}
+	return skipLine(f)
+}
+
+// skipLine moves f past the end of the line it is in
+func skipLine(f *os.File) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			_, err := f.Seek(int64(i+1-n), io.SeekCurrent)
+			return err
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readSegment emits the lines of a rotated log file
+func readSegment(path string, emit func([]byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, gzipSuffix) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	rest, err := readLines(r, emit)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return emit(rest)
+	}
+	return nil
+}
+
+// readLines emits the whole lines read from r until EOF and returns the rest
+func readLines(r io.Reader, emit func([]byte) error) ([]byte, error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := emit(line); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tailBuffer keeps the last n lines added to it
+type tailBuffer struct {
+	n     int
+	next  int
+	full  bool
+	items [][]byte
+}
+
+func newTailBuffer(n int) *tailBuffer {
+	if n < 0 {
+		n = 0
+	}
+	return &tailBuffer{
+		n:     n,
+		items: make([][]byte, n),
+	}
+}
+
+func (t *tailBuffer) add(line []byte) {
+	if t.n == 0 {
+		return
+	}
+	t.items[t.next] = line
+	t.next = (t.next + 1) % t.n
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+func (t *tailBuffer) lines() [][]byte {
+	if !t.full {
+		return t.items[:t.next]
+	}
+	return append(append([][]byte{}, t.items[t.next:]...), t.items[:t.next]...)
+}
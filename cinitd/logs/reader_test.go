@@ -0,0 +1,263 @@
+package logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while a followed stream writes to it
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func writeGzip(t *testing.T, path, data string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestLogs creates the rotated and the current log files of web: a compressed
+// segment, an uncompressed one and the current file that ends without a newline
+func newTestLogs(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(t.TempDir(), nil, TargetFile, nil)
+	path := m.Path("web", Stdout)
+
+	writeGzip(t, path+".20211018-101000.000.gz", "l1\nl2\n")
+	if err := ioutil.WriteFile(path+".20211018-102000.000", []byte("l3\nl4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("l5\nl6"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func readStream(t *testing.T, m *Manager, names []string, opts ReadOptions) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := m.Stream(context.Background(), names, opts, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestStream(t *testing.T) {
+	m := newTestLogs(t)
+
+	tests := []struct {
+		tail int
+		want string
+	}{
+		{want: "l1\nl2\nl3\nl4\nl5\nl6\n"},
+		{tail: 3, want: "l4\nl5\nl6\n"},
+		{tail: 10, want: "l1\nl2\nl3\nl4\nl5\nl6\n"},
+	}
+	for _, tt := range tests {
+		if got := readStream(t, m, []string{"web"}, ReadOptions{Tail: tt.tail}); got != tt.want {
+			t.Errorf("tail %d: got %q, want %q", tt.tail, got, tt.want)
+		}
+	}
+
+	if got := readStream(t, m, []string{"web"}, ReadOptions{Stream: Stderr}); got != "" {
+		t.Errorf("got %q from a missing stderr log", got)
+	}
+}
+
+func TestStreamReplicas(t *testing.T) {
+	m := NewManager(t.TempDir(), nil, TargetFile, nil)
+	for name, data := range map[string]string{"web-0": "a1\na2\n", "web-1": "b1\n"} {
+		if err := ioutil.WriteFile(m.Path(name, Stdout), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := readStream(t, m, []string{"web-0", "web-1"}, ReadOptions{Tail: 1})
+	if want := "[web-0] a2\n[web-1] b1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStreamSince(t *testing.T) {
+	m := newTestLogs(t)
+	path := m.Path("web", Stdout)
+
+	// Rotated files written before since are skipped
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path+".20211018-101000.000.gz", old, old); err != nil {
+		t.Fatal(err)
+	}
+	got := readStream(t, m, []string{"web"}, ReadOptions{Since: time.Now().Add(-time.Minute)})
+	if want := "l3\nl4\nl5\nl6\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStreamFollow(t *testing.T) {
+	m := NewManager(t.TempDir(), nil, TargetFile, nil)
+	w, err := m.Writer("web", Stdout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	write(t, w, "before\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var out syncBuffer
+	done := make(chan error)
+	go func() {
+		done <- m.Stream(ctx, []string{"web"}, ReadOptions{Follow: true}, &out)
+	}()
+
+	wait := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for out.String() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("got %q, want %q", out.String(), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	wait("before\n")
+
+	// A line is written once it is whole
+	write(t, w, "after")
+	time.Sleep(2 * followInterval)
+	write(t, w, " start\n")
+	wait("before\nafter start\n")
+
+	// Output written to the old file before a rotation is not lost
+	w.Lock()
+	w.file.Write([]byte("last of old\n"))
+	err = w.rotate()
+	w.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, w, "first of new\n")
+	wait("before\nafter start\nlast of old\nfirst of new\n")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not return after its context was done")
+	}
+}
+
+func TestSeekSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	w := NewWriter(path, Rotation{})
+	defer w.Close()
+	write(t, w, "l1\nl2\nl3 starts")
+	write(t, w, " and ends\nl4\n")
+
+	// Marks are kept per second, set them to known times
+	base := time.Now().Truncate(time.Second).Add(-time.Hour)
+	w.Lock()
+	w.marks = []mark{
+		{time: base, offset: 0},
+		{time: base.Add(time.Minute), offset: 3},
+		{time: base.Add(2 * time.Minute), offset: 15},
+		{time: base.Add(3 * time.Minute), offset: 25},
+	}
+	w.Unlock()
+
+	rest := func(f *os.File) string {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name   string
+		writer *Writer
+		since  time.Time
+		want   string
+	}{
+		{name: "zero", writer: w, want: "l1\nl2\nl3 starts and ends\nl4\n"},
+		{name: "mark at a line", writer: w, since: base.Add(time.Minute), want: "l2\nl3 starts and ends\nl4\n"},
+		{name: "mark within a second", writer: w, since: base.Add(time.Minute + 500*time.Millisecond), want: "l2\nl3 starts and ends\nl4\n"},
+		{name: "mark in a line", writer: w, since: base.Add(90 * time.Second), want: "l4\n"},
+		{name: "after the marks", writer: w, since: time.Now().Add(-time.Minute), want: "l1\nl2\nl3 starts and ends\nl4\n"},
+		{name: "after the last write", writer: w, since: time.Now().Add(time.Minute), want: ""},
+		{name: "no writer", since: time.Now().Add(-time.Minute), want: "l1\nl2\nl3 starts and ends\nl4\n"},
+		{name: "no writer, old file", since: time.Now().Add(time.Minute), want: ""},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := seekSince(f, tt.writer, tt.since); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else if got := rest(f); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		f.Close()
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		n    int
+		add  []string
+		want []string
+	}{
+		{n: 0, add: []string{"a", "b"}},
+		{n: -1, add: []string{"a"}},
+		{n: 3},
+		{n: 3, add: []string{"a", "b"}, want: []string{"a", "b"}},
+		{n: 3, add: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{n: 3, add: []string{"a", "b", "c", "d", "e"}, want: []string{"c", "d", "e"}},
+		{n: 2, add: []string{"a", "b", "c", "d"}, want: []string{"c", "d"}},
+	}
+	for _, tt := range tests {
+		tb := newTailBuffer(tt.n)
+		for _, line := range tt.add {
+			tb.add([]byte(line))
+		}
+		var got []string
+		for _, line := range tb.lines() {
+			got = append(got, string(line))
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("n %d, added %v: got %v, want %v", tt.n, tt.add, got, tt.want)
+		}
+	}
+}
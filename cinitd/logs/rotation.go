@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// Rotation holds the resolved rotation settings of a log file. Zero values disable
+// rotation by size or by age. A MaxFiles of zero keeps all rotated files
+type Rotation struct {
+	MaxSize  int64
+	MaxAge   time.Duration
+	MaxFiles int
+	Compress bool
+}
+
+// Enabled reports whether the log file is rotated at all
+func (r Rotation) Enabled() bool {
+	return r.MaxSize > 0 || r.MaxAge > 0
+}
+
+// ParseSize parses a size in bytes with an optional K, M or G suffix
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	value, multiplier := s, int64(1)
+	suffixes := map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30}
+	if m, ok := suffixes[strings.ToUpper(s[len(s)-1:])[0]]; ok {
+		value, multiplier = s[:len(s)-1], m
+	}
+
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s is not a valid size", s)
+	}
+	return v * multiplier, nil
+}
+
+// Validate checks the rotation settings of a service or the defaults of cinitd
+func Validate(r *models.LogRotation) error {
+	if r == nil {
+		return nil
+	}
+	if _, err := ParseSize(r.MaxSize); err != nil {
+		return fmt.Errorf("maxSize: %s", err)
+	}
+	if r.MaxAge < 0 || r.MaxFiles < 0 {
+		return fmt.Errorf("maxAge and maxFiles can not be negative")
+	}
+	return nil
+}
+
+// Resolve returns the rotation settings of a service. Fields the service does not set are
+// taken from defaults
+func Resolve(defaults, service *models.LogRotation) (Rotation, error) {
+	var r Rotation
+	for _, j := range []*models.LogRotation{defaults, service} {
+		if j == nil {
+			continue
+		}
+		if j.MaxSize != "" {
+			size, err := ParseSize(j.MaxSize)
+			if err != nil {
+				return r, fmt.Errorf("maxSize: %s", err)
+			}
+			r.MaxSize = size
+		}
+		if j.MaxAge > 0 {
+			r.MaxAge = j.MaxAge.D()
+		}
+		if j.MaxFiles > 0 {
+			r.MaxFiles = j.MaxFiles
+		}
+		if j.Compress != nil {
+			r.Compress = *j.Compress
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,315 @@
+package logs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// segmentTime is the suffix of rotated log files. It sorts in the order the files
+	// were rotated
+	segmentTime = "20060102-150405.000"
+
+	gzipSuffix = ".gz"
+	tmpSuffix  = ".tmp"
+
+	// maxMarks limits the marks kept for a log file. Every other mark is dropped once
+	// the limit is reached
+	maxMarks = 4096
+)
+
+// mark records the offset of the first write to a log file within a second
+type mark struct {
+	time   time.Time
+	offset int64
+}
+
+// Writer appends to a log file and rotates it by size and by age. Rotated files are
+// renamed to <path>.<time>, and compressed to <path>.<time>.gz if enabled. The file is
+// opened on the first write and reopened after Close
+type Writer struct {
+	sync.Mutex
+	path     string
+	rotation Rotation
+	file     *os.File
+	size     int64
+	started  time.Time
+	marks    []mark
+	compress sync.WaitGroup
+}
+
+// NewWriter returns a Writer for the log file at path
+func NewWriter(path string, rotation Rotation) *Writer {
+	return &Writer{
+		path:     path,
+		rotation: rotation,
+	}
+}
+
+// Path returns the path of the current log file
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// SetRotation changes the rotation settings of the writer
+func (w *Writer) SetRotation(rotation Rotation) {
+	w.Lock()
+	w.rotation = rotation
+	w.Unlock()
+}
+
+// Write appends p to the log file. The file is rotated before the write if it has
+// reached its maximum size or age
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.size > 0 && w.due(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+
+	now := time.Now().Truncate(time.Second)
+	if len(w.marks) == 0 || w.marks[len(w.marks)-1].time.Before(now) {
+		w.addMark(mark{time: now, offset: w.size})
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) addMark(m mark) {
+	if len(w.marks) >= maxMarks {
+		thinned := w.marks[:0]
+		for i := 0; i < len(w.marks); i += 2 {
+			thinned = append(thinned, w.marks[i])
+		}
+		w.marks = thinned
+	}
+	w.marks = append(w.marks, m)
+}
+
+// sinceOffset returns the offset of the first write at or after since to the log file
+// described by info. It reports false if the writer has no marks for that file or
+// none at or after since
+func (w *Writer) sinceOffset(info os.FileInfo, since time.Time) (int64, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.file == nil || len(w.marks) == 0 {
+		return 0, false
+	}
+	current, err := w.file.Stat()
+	if err != nil || !os.SameFile(current, info) {
+		return 0, false
+	}
+
+	since = since.Truncate(time.Second)
+	for _, m := range w.marks {
+		if !m.time.Before(since) {
+			return m.offset, true
+		}
+	}
+	return 0, false
+}
+
+// Close closes the log file and waits for running compressions to finish
+func (w *Writer) Close() error {
+	w.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.Unlock()
+
+	w.compress.Wait()
+	return err
+}
+
+// due reports whether the file has to be rotated before writing n more bytes
+func (w *Writer) due(n int64) bool {
+	if w.rotation.MaxSize > 0 && w.size+n > w.rotation.MaxSize {
+		return true
+	}
+	return w.rotation.MaxAge > 0 && time.Since(w.started) >= w.rotation.MaxAge
+}
+
+// fileStart returns when the first line was written to a non empty log file: its birth
+// time, or else the time the previous file was rotated, or else its modification time.
+// Age based rotation counts from it, so that reopening the file does not postpone it
+func fileStart(path string, f *os.File, info os.FileInfo) time.Time {
+	var stx unix.Statx_t
+	err := unix.Statx(int(f.Fd()), "", unix.AT_EMPTY_PATH, unix.STATX_BTIME, &stx)
+	if err == nil && stx.Mask&unix.STATX_BTIME != 0 {
+		return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+
+	if segments, err := Segments(path); err == nil && len(segments) > 0 {
+		base := strings.TrimSuffix(segments[len(segments)-1], gzipSuffix)
+		if t, err := time.ParseInLocation(segmentTime, strings.TrimPrefix(base, path+"."), time.Local); err == nil {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0760); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.started = time.Time{}
+	if w.size > 0 {
+		w.started = fileStart(w.path, f, info)
+	}
+	w.marks = nil
+	return nil
+}
+
+// rotate renames the current file, opens a new one and removes the rotated files that
+// exceed MaxFiles
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	segment := w.path + "." + time.Now().Format(segmentTime)
+	if err := os.Rename(w.path, segment); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.rotation.Compress {
+		w.compress.Add(1)
+		go func(maxFiles int) {
+			defer w.compress.Done()
+			if err := compressFile(segment); err == nil {
+				os.Remove(segment)
+			}
+			prune(w.path, maxFiles)
+		}(w.rotation.MaxFiles)
+		return nil
+	}
+
+	prune(w.path, w.rotation.MaxFiles)
+	return nil
+}
+
+// compressFile writes a gzip copy of path to path.gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + gzipSuffix + tmpSuffix
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path+gzipSuffix)
+}
+
+// Segments returns the rotated files of the log file at path, oldest first. A segment
+// that is being compressed is returned once
+func Segments(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]string)
+	for _, m := range matches {
+		if strings.HasSuffix(m, tmpSuffix) {
+			continue
+		}
+		base := strings.TrimSuffix(m, gzipSuffix)
+		if _, err := time.Parse(segmentTime, strings.TrimPrefix(base, path+".")); err != nil {
+			continue
+		}
+		// Prefer the uncompressed file while the compressed one is being written
+		if prev, ok := found[base]; !ok || strings.HasSuffix(prev, gzipSuffix) {
+			found[base] = m
+		}
+	}
+
+	bases := make([]string, 0, len(found))
+	for base := range found {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	segments := make([]string, 0, len(bases))
+	for _, base := range bases {
+		segments = append(segments, found[base])
+	}
+	return segments, nil
+}
+
+// prune removes the oldest rotated files of the log file at path, keeping maxFiles.
+// Nothing is removed if maxFiles is zero
+func prune(path string, maxFiles int) {
+	if maxFiles <= 0 {
+		return
+	}
+
+	segments, err := Segments(path)
+	if err != nil || len(segments) <= maxFiles {
+		return
+	}
+	for _, s := range segments[:len(segments)-maxFiles] {
+		base := strings.TrimSuffix(s, gzipSuffix)
+		os.Remove(base)
+		os.Remove(base + gzipSuffix)
+	}
+}
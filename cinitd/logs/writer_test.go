@@ -0,0 +1,227 @@
+package logs
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, w *Writer, s string) {
+	t.Helper()
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func segments(t *testing.T, path string) []string {
+	t.Helper()
+	s, err := Segments(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, gzipSuffix) {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriterRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	w := NewWriter(path, Rotation{MaxSize: 10})
+	defer w.Close()
+
+	write(t, w, "line 1\n")
+	write(t, w, "line 2\n")
+	time.Sleep(2 * time.Millisecond)
+	write(t, w, "line 3\n")
+
+	got := segments(t, path)
+	if len(got) != 2 {
+		t.Fatalf("got segments %v, want 2", got)
+	}
+	if s := readLog(t, got[0]); s != "line 1\n" {
+		t.Errorf("oldest segment holds %q", s)
+	}
+	if s := readLog(t, got[1]); s != "line 2\n" {
+		t.Errorf("newest segment holds %q", s)
+	}
+	if s := readLog(t, path); s != "line 3\n" {
+		t.Errorf("log file holds %q", s)
+	}
+}
+
+func TestWriterRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	w := NewWriter(path, Rotation{MaxAge: 100 * time.Millisecond})
+	defer w.Close()
+
+	write(t, w, "old\n")
+	write(t, w, "still young\n")
+	if got := segments(t, path); len(got) != 0 {
+		t.Fatalf("rotated a young file: %v", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	write(t, w, "new\n")
+	got := segments(t, path)
+	if len(got) != 1 || readLog(t, got[0]) != "old\nstill young\n" {
+		t.Fatalf("got segments %v, want the old lines rotated", got)
+	}
+	if s := readLog(t, path); s != "new\n" {
+		t.Errorf("log file holds %q", s)
+	}
+}
+
+func TestWriterAgeSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	w := NewWriter(path, Rotation{MaxAge: 200 * time.Millisecond})
+	defer w.Close()
+
+	// A service that restarts often closes and reopens its log, which must not reset
+	// the age of the file
+	for i := 0; i < 6; i++ {
+		write(t, w, "run\n")
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if got := segments(t, path); len(got) != 1 {
+		t.Errorf("got segments %v, want the file rotated once", got)
+	}
+}
+
+func TestWriterAgeOfExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	if err := ioutil.WriteFile(path, []byte("before restart\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWriter(path, Rotation{MaxAge: time.Hour})
+	defer w.Close()
+	write(t, w, "after restart\n")
+
+	if w.started.IsZero() || time.Since(w.started) > time.Minute {
+		t.Errorf("start of an existing file is %s", w.started)
+	}
+}
+
+func TestWriterCompresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-out.log")
+	w := NewWriter(path, Rotation{MaxSize: 10, Compress: true})
+
+	write(t, w, "first line\n")
+	write(t, w, "second line\n")
+	// Close waits for the compression
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := segments(t, path)
+	if len(got) != 1 || !strings.HasSuffix(got[0], gzipSuffix) {
+		t.Fatalf("got segments %v, want one compressed segment", got)
+	}
+	if s := readLog(t, got[0]); s != "first line\n" {
+		t.Errorf("compressed segment holds %q", s)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(got[0], gzipSuffix)); !os.IsNotExist(err) {
+		t.Error("uncompressed segment was kept")
+	}
+	if _, err := os.Stat(got[0] + tmpSuffix); !os.IsNotExist(err) {
+		t.Error("temporary file was kept")
+	}
+}
+
+func TestWriterKeepsMaxFiles(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "web-out.log")
+		w := NewWriter(path, Rotation{MaxSize: 4, MaxFiles: 2, Compress: compress})
+
+		for _, line := range []string{"l1\n", "l2\n", "l3\n", "l4\n", "l5\n"} {
+			write(t, w, line)
+			time.Sleep(2 * time.Millisecond)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := segments(t, path)
+		if len(got) != 2 {
+			t.Fatalf("compress %v: got segments %v, want 2", compress, got)
+		}
+		if s := readLog(t, got[0]) + readLog(t, got[1]); s != "l3\nl4\n" {
+			t.Errorf("compress %v: kept segments hold %q, want the newest ones", compress, s)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "web-out.log")
+	files := []string{
+		"web-out.log",
+		"web-out.log.20211018-101500.000.gz",
+		"web-out.log.20211018-101000.000",
+		"web-out.log.20211018-102000.000",
+		"web-out.log.20211018-102000.000.gz.tmp",
+		"web-out.log.20211018-103000.000",
+		"web-out.log.20211018-103000.000.gz",
+		"web-out.log.old",
+		"web-err.log.20211018-101000.000",
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		path + ".20211018-101000.000",
+		path + ".20211018-101500.000.gz",
+		path + ".20211018-102000.000",
+		// Being compressed, the uncompressed file is read
+		path + ".20211018-103000.000",
+	}
+	got := segments(t, path)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got segments\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	prune(path, 1)
+	got = segments(t, path)
+	if len(got) != 1 || got[0] != want[3] {
+		t.Errorf("after pruning to 1 file got %v", got)
+	}
+	if _, err := os.Stat(want[3] + gzipSuffix); err != nil {
+		t.Error("compressed copy of the kept segment was removed")
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/channels"
+)
+
+// latencyBuckets are the upper bounds of the API latency histogram, in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Service is the state of the process of a service
+type Service struct {
+	Name      string
+	Instance  string
+	PID       int
+	Up        bool
+	Restarts  int
+	ExitCode  *int
+	StartTime *time.Time
+}
+
+// Pool is the state of the process pool
+type Pool struct {
+	Size          int
+	ZombiesReaped uint64
+	Services      []Service
+}
+
+// PoolSource returns the state of the process pool
+type PoolSource interface {
+	PoolMetrics() Pool
+}
+
+type requestKey struct {
+	listener, action, code string
+}
+
+type latencyKey struct {
+	listener, action string
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Registry collects the metrics of cinitd. API requests are counted by the listeners,
+// the state of the services is read from the process pool on every scrape
+type Registry struct {
+	sync.Mutex
+	pool        PoolSource
+	remote      *channels.Remote
+	serviceChan *channels.Service
+	requests    map[requestKey]uint64
+	latencies   map[latencyKey]*histogram
+}
+
+// NewRegistry returns a Registry reading the state of the services from pool and the
+// timeouts of the remote and service channels
+func NewRegistry(pool PoolSource, remote *channels.Remote, serviceChan *channels.Service) *Registry {
+	return &Registry{
+		pool:        pool,
+		remote:      remote,
+		serviceChan: serviceChan,
+		requests:    make(map[requestKey]uint64),
+		latencies:   make(map[latencyKey]*histogram),
+	}
+}
+
+// CountRequest counts an API request. listener is http or grpc, code the status of the
+// reply
+func (r *Registry) CountRequest(listener, action, code string) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	r.requests[requestKey{listener, action, code}]++
+	r.Unlock()
+}
+
+// ObserveLatency records the time an API request took
+func (r *Registry) ObserveLatency(listener, action string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	seconds := d.Seconds()
+
+	r.Lock()
+	defer r.Unlock()
+	key := latencyKey{listener, action}
+	h := r.latencies[key]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		r.latencies[key] = h
+	}
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
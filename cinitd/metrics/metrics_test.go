@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/channels"
+)
+
+type testPool Pool
+
+func (p testPool) PoolMetrics() Pool {
+	return Pool(p)
+}
+
+// scrape writes the metrics of r and returns the value of every sample, keyed by its name
+// and labels. Metrics without samples are keyed by their name
+func scrape(t *testing.T, r *Registry) map[string]float64 {
+	t.Helper()
+	var out bytes.Buffer
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			samples[strings.Fields(line)[2]] = 0
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %s", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestWrite(t *testing.T) {
+	started := time.Unix(1634483050, 0)
+	exitCode := 3
+	remote, serviceChan := channels.NewRemoteChannel(1), channels.NewServiceChannel(1, 1)
+	r := NewRegistry(testPool{
+		Size:          2,
+		ZombiesReaped: 4,
+		Services: []Service{
+			{Name: "web", Instance: "web-1", PID: os.Getpid(), Up: true, Restarts: 1, StartTime: &started},
+			{Name: "db", Instance: "db", Restarts: 2, ExitCode: &exitCode, StartTime: &started},
+		},
+	}, remote, serviceChan)
+	remote.Timeout()
+	remote.Timeout()
+	serviceChan.Timeout()
+	r.CountRequest("http", "status", "200")
+	r.CountRequest("http", "status", "200")
+	r.CountRequest("grpc", "stop", "PermissionDenied")
+	r.ObserveLatency("http", "status", 30*time.Millisecond)
+
+	samples := scrape(t, r)
+	want := map[string]float64{
+		`cinit_service_up{name="web",instance="web-1"}`:                                         1,
+		`cinit_service_up{name="db",instance="db"}`:                                             0,
+		`cinit_service_restarts_total{name="web",instance="web-1"}`:                             1,
+		`cinit_service_restarts_total{name="db",instance="db"}`:                                 2,
+		`cinit_service_last_exit_code{name="db",instance="db"}`:                                 3,
+		`cinit_service_start_time_seconds{name="db",instance="db"}`:                             1634483050,
+		`cinit_process_pool_size`:                                                               2,
+		`cinit_zombies_reaped_total`:                                                            4,
+		`cinit_channel_timeouts_total{channel="remote"}`:                                        2,
+		`cinit_channel_timeouts_total{channel="service"}`:                                       1,
+		`cinit_api_requests_total{listener="http",action="status",code="200"}`:                  2,
+		`cinit_api_requests_total{listener="grpc",action="stop",code="PermissionDenied"}`:       1,
+		`cinit_api_request_duration_seconds_bucket{listener="http",action="status",le="0.025"}`: 0,
+		`cinit_api_request_duration_seconds_bucket{listener="http",action="status",le="0.05"}`:  1,
+		`cinit_api_request_duration_seconds_bucket{listener="http",action="status",le="+Inf"}`:  1,
+		`cinit_api_request_duration_seconds_count{listener="http",action="status"}`:             1,
+		`cinit_service_resident_memory_bytes`:                                                   0,
+		`cinit_service_cpu_seconds_total`:                                                       0,
+		`cinit_api_request_duration_seconds`:                                                    0,
+	}
+	for k, v := range want {
+		got, ok := samples[k]
+		if !ok {
+			t.Errorf("%s is missing", k)
+		} else if got != v {
+			t.Errorf("%s is %v, want %v", k, got, v)
+		}
+	}
+
+	// Only running services have an exit code, CPU and memory usage of their own
+	if _, ok := samples[`cinit_service_last_exit_code{name="web",instance="web-1"}`]; ok {
+		t.Error("running service has an exit code")
+	}
+	if v := samples[`cinit_service_resident_memory_bytes{name="web",instance="web-1"}`]; v <= 0 {
+		t.Errorf("running service uses %v bytes of memory", v)
+	}
+	if _, ok := samples[`cinit_service_cpu_seconds_total{name="web",instance="web-1"}`]; !ok {
+		t.Error("CPU time of the running service is missing")
+	}
+	for _, name := range []string{"cinit_service_cpu_seconds_total", "cinit_service_resident_memory_bytes"} {
+		if _, ok := samples[name+`{name="db",instance="db"}`]; ok {
+			t.Errorf("%s is set for a stopped service", name)
+		}
+	}
+}
+
+func TestLabelsAreEscaped(t *testing.T) {
+	if got, want := labels("name", "a\"b\\c\nd"), `{name="a\"b\\c\nd"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestProcStat(t *testing.T) {
+	cpu, rss, err := procStat(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu < 0 || rss <= 0 {
+		t.Errorf("got %v CPU seconds and %d bytes", cpu, rss)
+	}
+	if _, _, err := procStat(-1); err == nil {
+		t.Error("no error for a missing process")
+	}
+}
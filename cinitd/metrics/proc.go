@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the USER_HZ the CPU times of /proc/<pid>/stat are counted in
+const clockTicks = 100
+
+// procStat returns the CPU time in seconds and the resident memory in bytes of a process
+// read from /proc/<pid>/stat
+func procStat(pid int) (float64, int64, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The command name may contain spaces, fields are parsed after its closing bracket.
+	// The first field after it is the state, field 3 of proc(5)
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 22 {
+		return 0, 0, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return float64(utime+stime) / clockTicks, rss * int64(os.Getpagesize()), nil
+}
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the text format written by Write
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats label pairs, given as name, value, name, value...
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricWriter writes the samples of the metrics in the Prometheus text format
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricWriter) sample(name, labels string, v float64) {
+	fmt.Fprintf(m.w, "%s%s %s\n", name, labels, formatFloat(v))
+}
+
+// Write writes all metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	m := &metricWriter{w: bufio.NewWriter(w)}
+
+	var pool Pool
+	if r.pool != nil {
+		pool = r.pool.PoolMetrics()
+	}
+	sort.Slice(pool.Services, func(i, j int) bool {
+		return pool.Services[i].Instance < pool.Services[j].Instance
+	})
+	r.writeServices(m, pool.Services)
+
+	m.header("cinit_process_pool_size", "gauge", "Number of process handlers in the process pool.")
+	m.sample("cinit_process_pool_size", "", float64(pool.Size))
+
+	m.header("cinit_zombies_reaped_total", "counter", "Exited children of cinitd reaped without a process handler.")
+	m.sample("cinit_zombies_reaped_total", "", float64(pool.ZombiesReaped))
+
+	m.header("cinit_channel_timeouts_total", "counter", "Waits on the internal channels that timed out.")
+	if r.remote != nil {
+		m.sample("cinit_channel_timeouts_total", labels("channel", "remote"), float64(r.remote.Timeouts()))
+	}
+	if r.serviceChan != nil {
+		m.sample("cinit_channel_timeouts_total", labels("channel", "service"), float64(r.serviceChan.Timeouts()))
+	}
+
+	r.writeRequests(m)
+
+	return m.w.Flush()
+}
+
+func (r *Registry) writeServices(m *metricWriter, services []Service) {
+	m.header("cinit_service_up", "gauge", "Whether the process of the service is running.")
+	for _, s := range services {
+		up := 0.0
+		if s.Up {
+			up = 1
+		}
+		m.sample("cinit_service_up", labels("name", s.Name, "instance", s.Instance), up)
+	}
+
+	m.header("cinit_service_restarts_total", "counter", "Restarts of the service by its restart policy or health check.")
+	for _, s := range services {
+		m.sample("cinit_service_restarts_total", labels("name", s.Name, "instance", s.Instance), float64(s.Restarts))
+	}
+
+	m.header("cinit_service_last_exit_code", "gauge", "Exit code of the last run of the service, -1 if it was killed by a signal or could not be started.")
+	for _, s := range services {
+		if s.ExitCode != nil {
+			m.sample("cinit_service_last_exit_code", labels("name", s.Name, "instance", s.Instance), float64(*s.ExitCode))
+		}
+	}
+
+	m.header("cinit_service_start_time_seconds", "gauge", "Start time of the last run of the service since the epoch.")
+	for _, s := range services {
+		if s.StartTime != nil {
+			seconds := float64(s.StartTime.UnixNano()) / 1e9
+			m.sample("cinit_service_start_time_seconds", labels("name", s.Name, "instance", s.Instance), seconds)
+		}
+	}
+
+	type usage struct {
+		labels string
+		cpu    float64
+		rss    int64
+	}
+	usages := make([]usage, 0, len(services))
+	for _, s := range services {
+		if !s.Up || s.PID <= 0 {
+			continue
+		}
+		cpu, rss, err := procStat(s.PID)
+		if err != nil {
+			continue
+		}
+		usages = append(usages, usage{labels("name", s.Name, "instance", s.Instance), cpu, rss})
+	}
+
+	m.header("cinit_service_cpu_seconds_total", "counter", "CPU time of the process of the service, read from /proc/<pid>/stat.")
+	for _, u := range usages {
+		m.sample("cinit_service_cpu_seconds_total", u.labels, u.cpu)
+	}
+
+	m.header("cinit_service_resident_memory_bytes", "gauge", "Resident memory of the process of the service, read from /proc/<pid>/stat.")
+	for _, u := range usages {
+		m.sample("cinit_service_resident_memory_bytes", u.labels, float64(u.rss))
+	}
+}
+
+func (r *Registry) writeRequests(m *metricWriter) {
+	r.Lock()
+	defer r.Unlock()
+
+	requests := make([]requestKey, 0, len(r.requests))
+	for k := range r.requests {
+		requests = append(requests, k)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.listener != b.listener {
+			return a.listener < b.listener
+		}
+		if a.action != b.action {
+			return a.action < b.action
+		}
+		return a.code < b.code
+	})
+
+	m.header("cinit_api_requests_total", "counter", "API requests by listener, action and reply status.")
+	for _, k := range requests {
+		m.sample("cinit_api_requests_total", labels("listener", k.listener, "action", k.action, "code", k.code), float64(r.requests[k]))
+	}
+
+	latencies := make([]latencyKey, 0, len(r.latencies))
+	for k := range r.latencies {
+		latencies = append(latencies, k)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		a, b := latencies[i], latencies[j]
+		if a.listener != b.listener {
+			return a.listener < b.listener
+		}
+		return a.action < b.action
+	})
+
+	m.header("cinit_api_request_duration_seconds", "histogram", "Time taken to reply to API requests. Streams are not included.")
+	for _, k := range latencies {
+		h := r.latencies[k]
+		for i, le := range latencyBuckets {
+			m.sample("cinit_api_request_duration_seconds_bucket", labels("listener", k.listener, "action", k.action, "le", formatFloat(le)), float64(h.buckets[i]))
+		}
+		m.sample("cinit_api_request_duration_seconds_bucket", labels("listener", k.listener, "action", k.action, "le", "+Inf"), float64(h.count))
+		m.sample("cinit_api_request_duration_seconds_sum", labels("listener", k.listener, "action", k.action), h.sum)
+		m.sample("cinit_api_request_duration_seconds_count", labels("listener", k.listener, "action", k.action), float64(h.count))
+	}
+}
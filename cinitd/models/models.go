@@ -3,11 +3,143 @@ package models
 import "time"
 
 type Service struct {
-	T       string   `json:"type"`
-	SUID    string   `json:"suid,omitempty"`
-	Name    string   `json:"name"`
-	Command string   `json:"command,omitempty"`
-	Args    []string `json:"args,omitempty"`
+	T        string            `json:"type"`
+	SUID     string            `json:"suid,omitempty"`
+	Name     string            `json:"name"`
+	Source   string            `json:"source,omitempty"`
+	Command  string            `json:"command,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Shell    bool              `json:"shell,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	EnvFile  []string          `json:"envFile,omitempty"`
+	CleanEnv bool              `json:"cleanEnv,omitempty"`
+
+	User                string      `json:"user,omitempty"`
+	Group               string      `json:"group,omitempty"`
+	SupplementaryGroups []string    `json:"supplementaryGroups,omitempty"`
+	WorkingDir          string      `json:"workingDir,omitempty"`
+	Credential          *Credential `json:"-"`
+
+	Restart string   `json:"restart,omitempty"`
+	Backoff *Backoff `json:"backoff,omitempty"`
+
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	ServiceType      string `json:"serviceType,omitempty"`
+	SuccessExitCodes []int  `json:"successExitCodes,omitempty"`
+	AbortOnFailure   bool   `json:"abortOnFailure,omitempty"`
+
+	Schedule   string   `json:"schedule,omitempty"`
+	Overlap    string   `json:"overlap,omitempty"`
+	Jitter     Duration `json:"jitter,omitempty"`
+	RunHistory int      `json:"runHistory,omitempty"`
+
+	Resources *Resources `json:"resources,omitempty"`
+
+	Limits      map[string]string `json:"limits,omitempty"`
+	Nice        *int              `json:"nice,omitempty"`
+	OOMScoreAdj *int              `json:"oomScoreAdj,omitempty"`
+	CPUAffinity []int             `json:"cpuAffinity,omitempty"`
+
+	StopSignal         string   `json:"stopSignal,omitempty"`
+	StopTimeout        Duration `json:"stopTimeout,omitempty"`
+	SignalProcessGroup bool     `json:"signalProcessGroup,omitempty"`
+
+	ReloadSignal  string   `json:"reloadSignal,omitempty"`
+	ReloadCommand []string `json:"reloadCommand,omitempty"`
+
+	LogRotation *LogRotation `json:"logRotation,omitempty"`
+	LogTarget   string       `json:"logTarget,omitempty"`
+
+	// Replicas is the number of processes started for the service. It is also the
+	// parameter of the scale action
+	Replicas int `json:"replicas,omitempty"`
+
+	// ReplicaOf and ReplicaIndex are set on the instances of a service with replicas.
+	// ReplicaOf is the SUID of the service
+	ReplicaOf    string `json:"-"`
+	ReplicaIndex int    `json:"-"`
+
+	// Signal and SignalGroup are the parameters of the signal action
+	Signal      string `json:"signal,omitempty"`
+	SignalGroup bool   `json:"signalGroup,omitempty"`
+
+	// Tail, Since and Stderr are the parameters of the logs action
+	Tail   int        `json:"tail,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+	Stderr bool       `json:"stderr,omitempty"`
+}
+
+// HealthCheck describes how the health of a running service is probed. Exactly one of
+// Exec, HTTP and TCP is set
+type HealthCheck struct {
+	Exec        []string   `json:"exec,omitempty" yaml:"exec,omitempty"`
+	HTTP        *HTTPCheck `json:"http,omitempty" yaml:"http,omitempty"`
+	TCP         string     `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	Interval    Duration   `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout     Duration   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries     int        `json:"retries,omitempty" yaml:"retries,omitempty"`
+	StartPeriod Duration   `json:"startPeriod,omitempty" yaml:"startPeriod,omitempty"`
+
+	// RestartAfter restarts the service after this many consecutive failed checks.
+	// Zero disables restarts
+	RestartAfter int `json:"restartAfter,omitempty" yaml:"restartAfter,omitempty"`
+}
+
+// HTTPCheck is a health check that sends a GET request to URL. The check passes if the
+// response status equals Status, or is a 2xx status when Status is not set
+type HTTPCheck struct {
+	URL    string `json:"url" yaml:"url"`
+	Status int    `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// Backoff controls how a service is restarted by its restart policy. The delay
+// doubles on every restart within Window, up to MaxDelay. Once MaxRestarts restarts
+// happened within Window the service is no longer restarted. MaxRestarts defaults to 10,
+// -1 restarts the service forever
+type Backoff struct {
+	Delay       Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	MaxDelay    Duration `json:"maxDelay,omitempty" yaml:"maxDelay,omitempty"`
+	MaxRestarts int      `json:"maxRestarts,omitempty" yaml:"maxRestarts,omitempty"`
+	Window      Duration `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// Resources holds the cgroup v2 limits of a service. Unset limits are not enforced
+type Resources struct {
+	// MemoryMax is written to memory.max. Bytes with an optional K, M, G or T suffix
+	MemoryMax string `json:"memoryMax,omitempty" yaml:"memoryMax,omitempty"`
+	// CPUMax is written to cpu.max, as "quota [period]" in microseconds
+	CPUMax   string `json:"cpuMax,omitempty" yaml:"cpuMax,omitempty"`
+	PidsMax  int64  `json:"pidsMax,omitempty" yaml:"pidsMax,omitempty"`
+	IOWeight int    `json:"ioWeight,omitempty" yaml:"ioWeight,omitempty"`
+}
+
+// LogRotation controls the rotation of the log files of a service. Unset fields fall
+// back to the defaults of cinitd
+type LogRotation struct {
+	// MaxSize rotates a log file once it reaches this size. Bytes with an optional K, M
+	// or G suffix
+	MaxSize string `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+	// MaxAge rotates a log file once it has been written for this long
+	MaxAge   Duration `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+	MaxFiles int      `json:"maxFiles,omitempty" yaml:"maxFiles,omitempty"`
+	Compress *bool    `json:"compress,omitempty" yaml:"compress,omitempty"`
+}
+
+// ResourceUsage is the usage of a service read from its cgroup
+type ResourceUsage struct {
+	Memory  int64    `json:"memory"`
+	CPUTime Duration `json:"cpuTime"`
+	Pids    int64    `json:"pids"`
+}
+
+// Credential holds the resolved ids a service runs with
+type Credential struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
 }
 
 type ServiceAction struct {
@@ -21,4 +153,59 @@ type ServiceAction struct {
 	Log        []byte     `json:"log,omitempty"`
 	Error      error      `json:"error,omitempty"`
 	ExitStatus string     `json:"exitStatus,omitempty"`
+
+	Restarts       int             `json:"restarts,omitempty"`
+	NextRestart    *time.Time      `json:"nextRestart,omitempty"`
+	RestartHistory []RestartRecord `json:"restartHistory,omitempty"`
+	Health         string          `json:"health,omitempty"`
+
+	NextRun *time.Time  `json:"nextRun,omitempty"`
+	Runs    []RunRecord `json:"runs,omitempty"`
+
+	Usage *ResourceUsage `json:"usage,omitempty"`
+
+	// StopResult is graceful when the last stop ended within the stop timeout, or
+	// killed when the process had to be killed
+	StopResult string `json:"stopResult,omitempty"`
+
+	Signal      string `json:"signal,omitempty"`
+	SignalGroup bool   `json:"signalGroup,omitempty"`
+	Message     string `json:"message,omitempty"`
+
+	// Argv is the command line the service has been started with
+	Argv []string `json:"argv,omitempty"`
+
+	Replicas  int             `json:"replicas,omitempty"`
+	Instances []ReplicaStatus `json:"instances,omitempty"`
+
+	Tail   int        `json:"tail,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+	Stderr bool       `json:"stderr,omitempty"`
+}
+
+// ReplicaStatus is the status of one replica of a service
+type ReplicaStatus struct {
+	Index      int        `json:"index"`
+	PUID       string     `json:"puid"`
+	PID        string     `json:"pid,omitempty"`
+	Status     string     `json:"status"`
+	Health     string     `json:"health,omitempty"`
+	StartTime  *time.Time `json:"startTime,omitempty"`
+	ExitTime   *time.Time `json:"exitTime,omitempty"`
+	ExitStatus string     `json:"exitStatus,omitempty"`
+	Restarts   int        `json:"restarts,omitempty"`
+}
+
+// RestartRecord records an automatic restart of a service
+type RestartRecord struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+}
+
+// RunRecord records a finished run of a scheduled service
+type RunRecord struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	ExitStatus string    `json:"exitStatus"`
+	ExitCode   int       `json:"exitCode"`
 }
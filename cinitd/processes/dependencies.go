@@ -0,0 +1,80 @@
+package processes
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// shutdownOrder groups the running handlers into layers. Every layer only holds services
+// that no running service of a later layer depends on, so stopping the layers in order
+// stops dependents before their dependencies. The caller must hold the lock
+func (d *ProcessOperator) shutdownOrder() [][]*ProcessHandler {
+	remaining := make(map[string]*ProcessHandler)
+	for puid, j := range d.processPool {
+		if j.exitTime == nil {
+			remaining[puid] = j
+		}
+	}
+
+	layers := make([][]*ProcessHandler, 0)
+	for len(remaining) > 0 {
+		required := make(map[string]bool)
+		for _, j := range remaining {
+			for _, dep := range j.service.DependsOn {
+				required[dep] = true
+			}
+		}
+
+		puids := make([]string, 0)
+		for puid, j := range remaining {
+			if !required[j.service.Name] {
+				puids = append(puids, puid)
+			}
+		}
+
+		// Registration rejects cycles, but never loop forever on a broken graph
+		if len(puids) == 0 {
+			for puid := range remaining {
+				puids = append(puids, puid)
+			}
+		}
+		sort.Slice(puids, func(a, b int) bool {
+			return instanceName(remaining[puids[a]].service) < instanceName(remaining[puids[b]].service)
+		})
+
+		layer := make([]*ProcessHandler, 0, len(puids))
+		for _, puid := range puids {
+			layer = append(layer, remaining[puid])
+			delete(remaining, puid)
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers
+}
+
+// stopLayer stops every handler of a layer at the same time, with the stop signal and
+// the stop timeout of its service, and waits for all of them to exit
+func (d *ProcessOperator) stopLayer(layer []*ProcessHandler) {
+	names := make([]string, 0, len(layer))
+	for _, j := range layer {
+		names = append(names, instanceName(j.service))
+	}
+	d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "ProcessQueue",
+	}).Infof("Stopping %s", strings.Join(names, ", "))
+
+	var wg sync.WaitGroup
+	for _, j := range layer {
+		wg.Add(1)
+		go func(handler *ProcessHandler) {
+			defer wg.Done()
+			d.stopHandler(handler)
+		}(j)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,232 @@
+package processes
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	// shellPath is the shell that runs the command of shell services
+	shellPath = "/bin/sh"
+
+	// defaultPath is searched for commands of services without PATH in their environment
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// privateEnvPrefixes are the prefixes of the variables of cinitd that hold API tokens and
+// service definitions. They are not passed to services or the commands they run
+var privateEnvPrefixes = []string{
+	"CINIT_TOKEN_",
+	"CINIT_SERVICE_",
+}
+
+// isPrivateEnv reports whether the variable key of cinitd must not reach services
+func isPrivateEnv(key string) bool {
+	for _, j := range privateEnvPrefixes {
+		if strings.HasPrefix(key, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceEnv builds the environment of a service. The base is either cinitd's own
+// environment without its private variables, or an empty one (cleanEnv). envFile entries
+// are applied in order and env entries last, so they win over everything else
+func serviceEnv(service models.Service) ([]string, error) {
+	env := make(map[string]string)
+
+	if !service.CleanEnv {
+		for _, kv := range os.Environ() {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || isPrivateEnv(pair[0]) {
+				continue
+			}
+			env[pair[0]] = pair[1]
+		}
+	}
+
+	for _, f := range service.EnvFile {
+		fileEnv, err := readEnvFile(f)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		for k, v := range fileEnv {
+			env[k] = v
+		}
+	}
+
+	for k, v := range service.Env {
+		env[k] = v
+	}
+
+	if service.ReplicaOf != "" {
+		env["CINIT_REPLICA_INDEX"] = strconv.Itoa(service.ReplicaIndex)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	environ := make([]string, 0, len(keys))
+	for _, k := range keys {
+		environ = append(environ, k+"="+env[k])
+	}
+
+	return environ, nil
+}
+
+// serviceArgv returns the command line of a service. Args of other services are passed as
+// they are. Shell services run command with /bin/sh -c and get args as positional
+// parameters, in which $VAR and ${VAR} references are replaced with values from the
+// environment of the service, and $$ with $
+func serviceArgv(service models.Service, env []string) []string {
+	if !service.Shell {
+		return append([]string{service.Command}, service.Args...)
+	}
+
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) == 2 {
+			vars[pair[0]] = pair[1]
+		}
+	}
+
+	args := make([]string, 0, len(service.Args))
+	for _, a := range service.Args {
+		args = append(args, expandVars(a, vars))
+	}
+	return append([]string{shellPath, "-c", service.Command, service.Name}, args...)
+}
+
+// lookPath finds the executable of a command like exec.LookPath, but searches the PATH of
+// the environment of the service instead of the one of cinitd. Relative PATH entries are
+// skipped
+func lookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return exec.LookPath(file)
+	}
+
+	path := defaultPath
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			path = strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		p := filepath.Join(dir, file)
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// expandVars replaces $NAME and ${NAME} with the value of NAME in vars, or with an empty
+// string if NAME is not set, and $$ with $. Any other $ is kept, so that shell parameters
+// like $@ or $1 reach the command unchanged
+func expandVars(s string, vars map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end > 0 && isVarName(s[i+2:i+2+end]) {
+				b.WriteString(vars[s[i+2:i+2+end]])
+				i += end + 2
+				continue
+			}
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := i + 1
+		for end < len(s) && isVarName(s[i+1:end+1]) {
+			end++
+		}
+		if end == i+1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString(vars[s[i+1:end]])
+		i = end - 1
+	}
+	return b.String()
+}
+
+// isVarName reports whether s is a valid environment variable name
+func isVarName(s string) bool {
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !(i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// readEnvFile parses a dotenv file. Empty lines and lines starting with # are ignored,
+// an optional export prefix is removed and values wrapped in single or double quotes
+// are unquoted
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer f.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		pair := strings.SplitN(line, "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, wrapErr("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+
+		key := strings.TrimSpace(pair[0])
+		value := strings.TrimSpace(pair[1])
+		if len(value) > 1 {
+			if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+				value = value[1 : len(value)-1]
+			}
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return env, nil
+}
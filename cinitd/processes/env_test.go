@@ -0,0 +1,239 @@
+package processes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// captureWriter collects the output of a process and reports when it has been closed
+type captureWriter struct {
+	bytes.Buffer
+	closed chan struct{}
+}
+
+func newCaptureWriter() *captureWriter {
+	return &captureWriter{closed: make(chan struct{})}
+}
+
+func (c *captureWriter) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestLookPath(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	// The tool in the first directory can not be executed
+	if err := ioutil.WriteFile(filepath.Join(first, "tool"), []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(second, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", first)
+
+	tests := []struct {
+		name, file string
+		env        []string
+		want       string
+	}{
+		{name: "service PATH", file: "tool", env: []string{"PATH=" + first + ":" + second}, want: filepath.Join(second, "tool")},
+		{name: "last PATH wins", file: "tool", env: []string{"PATH=/nonexistent", "PATH=" + second}, want: filepath.Join(second, "tool")},
+		{name: "relative entries are skipped", file: "tool", env: []string{"PATH=.:" + second}, want: filepath.Join(second, "tool")},
+		{name: "not in the service PATH", file: "tool", env: []string{"PATH=" + first}},
+		{name: "default PATH", file: "tool", env: []string{"HOME=/root"}},
+		{name: "path", file: filepath.Join(second, "tool"), env: []string{"PATH=" + first}, want: filepath.Join(second, "tool")},
+	}
+	for _, tt := range tests {
+		got, err := lookPath(tt.file, tt.env)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: found %s", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if got, err := lookPath("sh", nil); err != nil || !strings.HasSuffix(got, "/sh") {
+		t.Errorf("sh is not found in the default PATH: %q, %v", got, err)
+	}
+}
+
+// runService starts path with the environment of service and returns its stdout
+func runService(t *testing.T, service models.Service, path string, argv ...string) string {
+	t.Helper()
+
+	env, err := serviceEnv(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := newCaptureWriter(), newCaptureWriter()
+	uid, gid, groups := serviceCredential(service)
+	prc, err := newProcessFactory("test", t.TempDir(), uid, gid, groups, env, nil, stdout, stderr).exec(path, argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prc.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	<-stdout.closed
+	return stdout.String()
+}
+
+func TestServiceEnvHidesTokens(t *testing.T) {
+	t.Setenv("CINIT_TOKEN_ADMIN", "admin:s3cret")
+	t.Setenv("CINIT_TOKEN_VIEW", "viewer:v1ew")
+	t.Setenv("CINIT_TEST_VISIBLE", "yes")
+
+	out := runService(t, models.Service{Name: "env"}, "/usr/bin/env", "env")
+	if strings.Contains(out, "CINIT_TOKEN_") {
+		t.Errorf("service sees the API tokens:\n%s", out)
+	}
+	if !strings.Contains(out, "CINIT_TEST_VISIBLE=yes") {
+		t.Errorf("service does not see the environment of cinitd:\n%s", out)
+	}
+}
+
+func TestServiceEnvHidesServiceDefinitions(t *testing.T) {
+	t.Setenv("CINIT_SERVICE_DB", "bmFtZTogZGIKY29tbWFuZDogcG9zdGdyZXMKZW52OgogIFBBU1NXT1JEOiBzM2NyZXQK")
+	t.Setenv("CINIT_TEST_VISIBLE", "yes")
+
+	env, err := serviceEnv(models.Service{Name: "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(env, "\n")
+	if strings.Contains(out, "CINIT_SERVICE_") {
+		t.Errorf("service sees the service definitions of cinitd:\n%s", out)
+	}
+	if !strings.Contains(out, "CINIT_TEST_VISIBLE=yes") {
+		t.Errorf("service does not see the environment of cinitd:\n%s", out)
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]string{
+		"HOME":     "/root",
+		"GREETING": "hello world",
+		"A_1":      "a",
+		"EMPTY":    "",
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"$HOME", "/root"},
+		{"${HOME}/bin", "/root/bin"},
+		{"$HOME/bin", "/root/bin"},
+		{"$GREETING!", "hello world!"},
+		{"$A_1-$A_1", "a-a"},
+		{"${A_1}b", "ab"},
+		{"$A_1b", ""},
+		{"$MISSING", ""},
+		{"x${EMPTY}y", "xy"},
+		{"$$HOME", "$HOME"},
+		{"cost: 5$", "cost: 5$"},
+		{"$1 $@ $* $?", "$1 $@ $* $?"},
+		{"${1}", "${1}"},
+		{"${HOME", "${HOME"},
+		{"${}", "${}"},
+		{"$", "$"},
+	}
+	for _, tt := range tests {
+		if got := expandVars(tt.in, vars); got != tt.want {
+			t.Errorf("expandVars(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestServiceArgv(t *testing.T) {
+	env := []string{"GREETING=hello", "PASSWORD=secret"}
+	tests := []struct {
+		name    string
+		service models.Service
+		want    []string
+	}{
+		{
+			name:    "args are kept",
+			service: models.Service{Name: "echo", Command: "echo", Args: []string{"$GREETING", "p@$$w0rd", "^a.*$", "$1"}},
+			want:    []string{"echo", "$GREETING", "p@$$w0rd", "^a.*$", "$1"},
+		},
+		{
+			name:    "shell args are expanded",
+			service: models.Service{Name: "greet", Command: `echo "$1"`, Shell: true, Args: []string{"$GREETING", "$$PASSWORD", "$1"}},
+			want:    []string{shellPath, "-c", `echo "$1"`, "greet", "hello", "$PASSWORD", "$1"},
+		},
+		{
+			name:    "no args",
+			service: models.Service{Name: "true", Command: "true"},
+			want:    []string{"true"},
+		},
+	}
+	for _, tt := range tests {
+		got := serviceArgv(tt.service, env)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.env")
+	data := `# comment
+DB_HOST=db
+
+export DB_PORT = 5432
+QUOTED="hello world"
+SINGLE='$HOME'
+EMPTY=
+EQUALS=a=b=c
+  INDENTED=yes
+HALF="open
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DB_HOST":  "db",
+		"DB_PORT":  "5432",
+		"QUOTED":   "hello world",
+		"SINGLE":   "$HOME",
+		"EMPTY":    "",
+		"EQUALS":   "a=b=c",
+		"INDENTED": "yes",
+		"HALF":     `"open`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadEnvFileErrors(t *testing.T) {
+	if _, err := readEnvFile(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("no error for a missing file")
+	}
+
+	for _, line := range []string{"NOVALUE", "=value", "export"} {
+		path := filepath.Join(t.TempDir(), "bad.env")
+		if err := ioutil.WriteFile(path, []byte("OK=1\n"+line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := readEnvFile(path)
+		if err == nil || !strings.Contains(err.Error(), "bad.env:2") {
+			t.Errorf("%q: got error %v, want one for line 2", line, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package processes
+
+import (
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// serviceEvent fills the service fields of an event. Events of replicas carry the name of
+// the service and the name of the instance
+func serviceEvent(service models.Service, e events.Event) events.Event {
+	e.Name = service.Name
+	if service.ReplicaOf != "" {
+		e.Instance = instanceName(service)
+	}
+	return e
+}
+
+// publish sends an event of the service run by the handler
+func (w *ProcessHandler) publish(e events.Event) {
+	if w.events == nil {
+		return
+	}
+	e.PUID = w.puid
+	w.events.Publish(serviceEvent(w.service, e))
+}
@@ -0,0 +1,103 @@
+package processes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	// execHelperName is the argv[0] under which cinitd runs as the exec helper
+	execHelperName = "cinitd-exec"
+	// execHelperStatusFd is the descriptor the exec helper reports its errors to. It is
+	// closed on exec, so the parent reads nothing when the command has been executed
+	execHelperStatusFd = 3
+)
+
+// execSpec is what the exec helper applies before it executes the command of a service.
+// Groups is nil when the groups of cinitd are kept
+type execSpec struct {
+	Path        string            `json:"path"`
+	Argv        []string          `json:"argv"`
+	Limits      map[string]string `json:"limits,omitempty"`
+	Nice        *int              `json:"nice,omitempty"`
+	OOMScoreAdj *int              `json:"oomScoreAdj,omitempty"`
+	CPUAffinity []int             `json:"cpuAffinity,omitempty"`
+	UID         uint32            `json:"uid"`
+	GID         uint32            `json:"gid"`
+	Groups      []uint32          `json:"groups"`
+}
+
+// newExecSpec returns the execSpec of a service that runs path with argv
+func newExecSpec(service models.Service, path string, argv []string) *execSpec {
+	uid, gid, groups := serviceCredential(service)
+	return &execSpec{
+		Path:        path,
+		Argv:        argv,
+		Limits:      service.Limits,
+		Nice:        service.Nice,
+		OOMScoreAdj: service.OOMScoreAdj,
+		CPUAffinity: service.CPUAffinity,
+		UID:         uid,
+		GID:         gid,
+		Groups:      groups,
+	}
+}
+
+// RunExecHelper turns cinitd into the exec helper when it has been started as one, and
+// returns otherwise. The helper runs with the privileges of cinitd inside the cgroup of a
+// service, sets the limits of the service, drops to its credentials and executes its
+// command, so that the limits are in place before the command runs. It must be called
+// before anything else in main
+func RunExecHelper() {
+	if filepath.Base(os.Args[0]) != execHelperName {
+		return
+	}
+
+	// Nice and affinity belong to the thread that executes the command
+	runtime.LockOSThread()
+
+	status := os.NewFile(execHelperStatusFd, "status")
+	syscall.CloseOnExec(execHelperStatusFd)
+
+	err := runExecHelper(os.Args[1:])
+	fmt.Fprint(status, err)
+	os.Exit(127)
+}
+
+func runExecHelper(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s: expected one argument", execHelperName)
+	}
+	var spec execSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return fmt.Errorf("%s: %s", execHelperName, err)
+	}
+
+	if err := setLimits(&spec); err != nil {
+		return err
+	}
+
+	if spec.Groups != nil {
+		groups := make([]int, 0, len(spec.Groups))
+		for _, g := range spec.Groups {
+			groups = append(groups, int(g))
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("setgroups: %s", err)
+		}
+	}
+	if err := syscall.Setgid(int(spec.GID)); err != nil {
+		return fmt.Errorf("setgid: %s", err)
+	}
+	if err := syscall.Setuid(int(spec.UID)); err != nil {
+		return fmt.Errorf("setuid: %s", err)
+	}
+
+	return syscall.Exec(spec.Path, spec.Argv, os.Environ())
+}
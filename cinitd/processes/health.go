@@ -0,0 +1,223 @@
+package processes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 10 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// healthMonitor holds the health of a running service
+type healthMonitor struct {
+	sync.Mutex
+	status   string
+	failures int
+}
+
+func newHealthMonitor() *healthMonitor {
+	return &healthMonitor{
+		status: healthStarting,
+	}
+}
+
+// get returns the current health status and the number of consecutive failed checks
+func (h *healthMonitor) get() (string, int) {
+	h.Lock()
+	defer h.Unlock()
+	return h.status, h.failures
+}
+
+// monitorHealth probes the service of the handler until ctx is canceled. A service is
+// healthy after its first passing check and unhealthy after retries consecutive failed
+// checks. Failed checks within the start period are not counted. After restartAfter
+// consecutive failed checks the handler asks for the service to be restarted
+func (w *ProcessHandler) monitorHealth(ctx context.Context, startTime time.Time) {
+	hc := w.service.HealthCheck
+	log := w.logger.WithFields(logrus.Fields{
+		"Component": "ProcessHandler",
+		"Part":      "HealthCheck",
+		"PUID":      w.puid,
+		"Name":      instanceName(w.service),
+	})
+
+	interval, timeout, retries := defaultHealthInterval, defaultHealthTimeout, defaultHealthRetries
+	if hc.Interval > 0 {
+		interval = hc.Interval.D()
+	}
+	if hc.Timeout > 0 {
+		timeout = hc.Timeout.D()
+	}
+	if hc.Retries > 0 {
+		retries = hc.Retries
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var restartRequested bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := w.checkHealth(checkCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.health.Lock()
+		previous := w.health.status
+		if err == nil {
+			w.health.failures = 0
+			w.health.status = healthHealthy
+		} else if time.Since(startTime) >= hc.StartPeriod.D() {
+			w.health.failures++
+			if w.health.failures >= retries {
+				w.health.status = healthUnhealthy
+			}
+		}
+		status, failures := w.health.status, w.health.failures
+		w.health.Unlock()
+
+		if err != nil {
+			log.Debugf("Health check failed (%d/%d): %s", failures, retries, err)
+		}
+		if status != previous {
+			if status == healthUnhealthy {
+				log.Warnf("Service is unhealthy: %s", err)
+			} else {
+				log.Infof("Service is %s", status)
+			}
+
+			e := events.Event{
+				Type:   events.Health,
+				Health: status,
+			}
+			if err != nil {
+				e.Reason = err.Error()
+			}
+			w.publish(e)
+		}
+
+		if hc.RestartAfter > 0 && failures >= hc.RestartAfter && !restartRequested && w.onUnhealthy != nil {
+			restartRequested = true
+			go w.onUnhealthy(w, fmt.Sprintf("%d consecutive failed health checks: %s", failures, err))
+		}
+	}
+}
+
+// checkHealth runs a single health check
+func (w *ProcessHandler) checkHealth(ctx context.Context) error {
+	hc := w.service.HealthCheck
+	switch {
+	case len(hc.Exec) > 0:
+		return w.runCommand(ctx, hc.Exec)
+	case hc.HTTP != nil:
+		return checkHTTP(ctx, hc.HTTP)
+	case hc.TCP != "":
+		return checkTCP(ctx, hc.TCP)
+	}
+	return fmt.Errorf("health check has no exec, http or tcp probe")
+}
+
+// runCommand runs a command with the environment, credentials and working directory of
+// the service. It fails if the command does not exit with 0
+func (w *ProcessHandler) runCommand(ctx context.Context, argv []string) error {
+	env, err := serviceEnv(w.service)
+	if err != nil {
+		return err
+	}
+	uid, gid, groups := serviceCredential(w.service)
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	cmd.Dir = serviceDir(w.service)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Children of a killed command may still hold its output
+	cmd.WaitDelay = time.Second
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:         uid,
+			Gid:         gid,
+			Groups:      groups,
+			NoSetGroups: groups == nil,
+		},
+	}
+
+	// The zombie reaper must not collect the exit status of the command
+	err = w.reaper.run(cmd)
+	if err != nil {
+		out := strings.TrimSpace(output.String())
+		if len(out) > 256 {
+			out = out[:256]
+		}
+		if out != "" {
+			return fmt.Errorf("%s: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkHTTP sends a GET request and compares the response status
+func checkHTTP(ctx context.Context, check *models.HTTPCheck) error {
+	req, err := http.NewRequest("GET", check.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if check.Status != 0 {
+		if resp.StatusCode != check.Status {
+			return fmt.Errorf("expected status %d but received %d", check.Status, resp.StatusCode)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("received status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkTCP opens and closes a TCP connection
+func checkTCP(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,285 @@
+package processes
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func newTestHandler(hc *models.HealthCheck) *ProcessHandler {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return &ProcessHandler{
+		puid:    "test",
+		service: models.Service{Name: "web", HealthCheck: hc},
+		logger:  logger,
+		health:  newHealthMonitor(),
+		reaper:  newReaper(),
+	}
+}
+
+// waitHealth polls the health of a handler until it is status or timeout passes
+func waitHealth(t *testing.T, w *ProcessHandler, status string, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if got, _ := w.health.get(); got == status {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got, failures := w.health.get()
+	t.Fatalf("health is %s after %d failures, want %s", got, failures, status)
+}
+
+func TestCheckHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(200)
+		case "/nocontent":
+			w.WriteHeader(204)
+		case "/down":
+			w.WriteHeader(503)
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		ok     bool
+	}{
+		{path: "/ok", ok: true},
+		{path: "/nocontent", ok: true},
+		{path: "/down"},
+		{path: "/nocontent", status: 204, ok: true},
+		{path: "/ok", status: 204},
+		{path: "/down", status: 503, ok: true},
+	}
+	for _, tt := range tests {
+		err := checkHTTP(context.Background(), &models.HTTPCheck{URL: srv.URL + tt.path, Status: tt.status})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s (status %d): error = %v, want healthy %v", tt.path, tt.status, err, tt.ok)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := checkHTTP(ctx, &models.HTTPCheck{URL: srv.URL + "/slow"}); err == nil {
+		t.Error("slow response passed a check with a timeout")
+	}
+}
+
+func TestCheckTCP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+
+	if err := checkTCP(context.Background(), address); err != nil {
+		t.Errorf("open port: %s", err)
+	}
+	lis.Close()
+	if err := checkTCP(context.Background(), address); err == nil {
+		t.Error("closed port passed the check")
+	}
+}
+
+func TestCheckExec(t *testing.T) {
+	w := newTestHandler(nil)
+
+	if err := w.runCommand(context.Background(), []string{"/bin/sh", "-c", "exit 0"}); err != nil {
+		t.Errorf("passing command: %s", err)
+	}
+
+	err := w.runCommand(context.Background(), []string{"/bin/sh", "-c", "echo database is down; exit 3"})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: database is down") {
+		t.Errorf("got error %v, want the exit status and output of the command", err)
+	}
+
+	if err := w.runCommand(context.Background(), []string{"/nonexistent/check"}); err == nil {
+		t.Error("missing command passed the check")
+	}
+}
+
+func TestCheckExecTimeout(t *testing.T) {
+	w := newTestHandler(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// The shell is killed on timeout, its sleep child still holds the output
+	err := w.runCommand(ctx, []string{"/bin/sh", "-c", "sleep 30; true"})
+	if err == nil {
+		t.Fatal("command passed the check after its timeout")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("check returned after %s", d)
+	}
+}
+
+func TestCheckExecDoesNotBlockReaper(t *testing.T) {
+	w := newTestHandler(nil)
+
+	done := make(chan error)
+	go func() {
+		done <- w.runCommand(context.Background(), []string{"/bin/sh", "-c", "sleep 0.5"})
+	}()
+
+	// Wait for the command to be started and registered
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w.reaper.waitedMu.Lock()
+		n := len(w.reaper.waited)
+		w.reaper.waitedMu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command was not registered with the reaper")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		w.reaper.Lock()
+		w.reaper.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(250 * time.Millisecond):
+		t.Error("the zombie reaper is blocked while the check runs")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(w.reaper.waited) != 0 {
+		t.Error("command is still registered after it exited")
+	}
+}
+
+func TestMonitorHealth(t *testing.T) {
+	flag := filepath.Join(t.TempDir(), "healthy")
+	w := newTestHandler(&models.HealthCheck{
+		Exec:     []string{"test", "-f", flag},
+		Interval: models.Duration(10 * time.Millisecond),
+		Timeout:  models.Duration(time.Second),
+		Retries:  2,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorHealth(ctx, time.Now())
+
+	if status, _ := w.health.get(); status != healthStarting {
+		t.Errorf("health is %s before the first check, want %s", status, healthStarting)
+	}
+	waitHealth(t, w, healthUnhealthy, 2*time.Second)
+
+	if err := ioutil.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitHealth(t, w, healthHealthy, 2*time.Second)
+	if _, failures := w.health.get(); failures != 0 {
+		t.Errorf("%d failures after a passing check", failures)
+	}
+
+	os.Remove(flag)
+	waitHealth(t, w, healthUnhealthy, 2*time.Second)
+}
+
+func TestMonitorHealthTimeout(t *testing.T) {
+	w := newTestHandler(&models.HealthCheck{
+		Exec:     []string{"sleep", "10"},
+		Interval: models.Duration(10 * time.Millisecond),
+		Timeout:  models.Duration(50 * time.Millisecond),
+		Retries:  1,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorHealth(ctx, time.Now())
+
+	waitHealth(t, w, healthUnhealthy, 3*time.Second)
+}
+
+func TestMonitorHealthStartPeriod(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+	lis.Close()
+
+	w := newTestHandler(&models.HealthCheck{
+		TCP:         address,
+		Interval:    models.Duration(10 * time.Millisecond),
+		Timeout:     models.Duration(time.Second),
+		Retries:     1,
+		StartPeriod: models.Duration(300 * time.Millisecond),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorHealth(ctx, time.Now())
+
+	// Failed checks within the start period are not counted
+	time.Sleep(200 * time.Millisecond)
+	if status, failures := w.health.get(); status != healthStarting || failures != 0 {
+		t.Fatalf("health is %s with %d failures within the start period", status, failures)
+	}
+
+	waitHealth(t, w, healthUnhealthy, 2*time.Second)
+}
+
+func TestMonitorHealthRestartAfter(t *testing.T) {
+	w := newTestHandler(&models.HealthCheck{
+		Exec:         []string{"false"},
+		Interval:     models.Duration(10 * time.Millisecond),
+		Timeout:      models.Duration(time.Second),
+		Retries:      1,
+		RestartAfter: 3,
+	})
+
+	restarted := make(chan string, 2)
+	w.onUnhealthy = func(h *ProcessHandler, reason string) {
+		restarted <- reason
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorHealth(ctx, time.Now())
+
+	select {
+	case reason := <-restarted:
+		if !strings.HasPrefix(reason, "3 consecutive failed health checks") {
+			t.Errorf("restart reason is %q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("service was not restarted")
+	}
+
+	// A restart is requested once per run
+	select {
+	case <-restarted:
+		t.Error("restart requested twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,120 @@
+package processes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ulfox/cinit/cinitd/models"
+	"golang.org/x/sys/unix"
+)
+
+// rlimits maps the supported limits of a service to their resource
+var rlimits = map[string]int{
+	"as":      unix.RLIMIT_AS,
+	"core":    unix.RLIMIT_CORE,
+	"cpu":     unix.RLIMIT_CPU,
+	"data":    unix.RLIMIT_DATA,
+	"fsize":   unix.RLIMIT_FSIZE,
+	"memlock": unix.RLIMIT_MEMLOCK,
+	"nofile":  unix.RLIMIT_NOFILE,
+	"nproc":   unix.RLIMIT_NPROC,
+	"stack":   unix.RLIMIT_STACK,
+}
+
+// RlimitNames lists the limits that can be set for a service
+func RlimitNames() []string {
+	names := make([]string, 0, len(rlimits))
+	for k := range rlimits {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseRlimit parses a limit of a service. A limit is a value used as both the soft and
+// the hard limit, or soft:hard. Values are numbers or unlimited
+func ParseRlimit(name, value string) (*unix.Rlimit, int, error) {
+	resource, ok := rlimits[strings.ToLower(name)]
+	if !ok {
+		return nil, 0, fmt.Errorf("%s is not supported", name)
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return nil, 0, fmt.Errorf("%s: %s is not in the soft[:hard] format", name, value)
+	}
+	values := make([]uint64, len(parts))
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "unlimited" || p == "infinity" {
+			values[i] = unix.RLIM_INFINITY
+			continue
+		}
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %s is not a number or unlimited", name, p)
+		}
+		values[i] = v
+	}
+
+	rlimit := &unix.Rlimit{Cur: values[0], Max: values[0]}
+	if len(values) == 2 {
+		rlimit.Max = values[1]
+	}
+	if rlimit.Cur > rlimit.Max {
+		return nil, 0, fmt.Errorf("%s: soft limit is greater than the hard limit", name)
+	}
+	return rlimit, resource, nil
+}
+
+// needsLimits reports whether a service sets limits that are applied before its command
+// is executed
+func needsLimits(service models.Service) bool {
+	return len(service.Limits) > 0 || service.Nice != nil || service.OOMScoreAdj != nil || len(service.CPUAffinity) > 0
+}
+
+// setLimits sets the limits, nice value, OOM score adjustment and CPU affinity of a
+// service to the calling process. Nice and affinity are set on the calling thread only,
+// which must be the one that executes the command of the service
+func setLimits(spec *execSpec) error {
+	for name, value := range spec.Limits {
+		rlimit, resource, err := ParseRlimit(name, value)
+		if err != nil {
+			return fmt.Errorf("limits: %s", err)
+		}
+		// syscall.Setrlimit keeps the Go runtime from restoring its own nofile limit on exec
+		err = syscall.Setrlimit(resource, &syscall.Rlimit{Cur: rlimit.Cur, Max: rlimit.Max})
+		if err != nil {
+			return fmt.Errorf("limits: %s: %s", name, err)
+		}
+	}
+
+	if spec.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *spec.Nice); err != nil {
+			return fmt.Errorf("nice: %s", err)
+		}
+	}
+
+	if spec.OOMScoreAdj != nil {
+		err := ioutil.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(*spec.OOMScoreAdj)), 0644)
+		if err != nil {
+			return fmt.Errorf("oomScoreAdj: %s", err)
+		}
+	}
+
+	if len(spec.CPUAffinity) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range spec.CPUAffinity {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			return fmt.Errorf("cpuAffinity: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package processes
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ulfox/cinit/cinitd/models"
+	"golang.org/x/sys/unix"
+)
+
+// TestMain lets the test binary run as the exec helper, like cinitd does
+func TestMain(m *testing.M) {
+	RunExecHelper()
+	os.Exit(m.Run())
+}
+
+func TestParseRlimit(t *testing.T) {
+	tests := []struct {
+		name, value string
+		resource    int
+		cur, max    uint64
+		err         bool
+	}{
+		{name: "nofile", value: "4096", resource: unix.RLIMIT_NOFILE, cur: 4096, max: 4096},
+		{name: "NPROC", value: "256:512", resource: unix.RLIMIT_NPROC, cur: 256, max: 512},
+		{name: "core", value: "0", resource: unix.RLIMIT_CORE, cur: 0, max: 0},
+		{name: "as", value: "unlimited", resource: unix.RLIMIT_AS, cur: unix.RLIM_INFINITY, max: unix.RLIM_INFINITY},
+		{name: "stack", value: "8388608:infinity", resource: unix.RLIMIT_STACK, cur: 8388608, max: unix.RLIM_INFINITY},
+		{name: "cpu", value: " 10 : 20 ", resource: unix.RLIMIT_CPU, cur: 10, max: 20},
+		{name: "nofile", value: "512:256", err: true},
+		{name: "nofile", value: "unlimited:1024", err: true},
+		{name: "nofile", value: "1:2:3", err: true},
+		{name: "nofile", value: "-1", err: true},
+		{name: "nofile", value: "", err: true},
+		{name: "nofile", value: "1k", err: true},
+		{name: "rss", value: "1024", err: true},
+	}
+	for _, tt := range tests {
+		rlimit, resource, err := ParseRlimit(tt.name, tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseRlimit(%q, %q) error = %v, want error %v", tt.name, tt.value, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if resource != tt.resource || rlimit.Cur != tt.cur || rlimit.Max != tt.max {
+			t.Errorf("ParseRlimit(%q, %q) = %d %d:%d, want %d %d:%d", tt.name, tt.value, resource, rlimit.Cur, rlimit.Max, tt.resource, tt.cur, tt.max)
+		}
+	}
+}
+
+// runLimited starts the shell script with the limits of service through the exec helper
+// and returns its stdout
+func runLimited(t *testing.T, service models.Service, script string) (string, error) {
+	t.Helper()
+
+	argv := []string{"/bin/sh", "-c", script}
+	stdout, stderr := newCaptureWriter(), newCaptureWriter()
+	uid, gid, groups := serviceCredential(service)
+	fork := newProcessFactory("test", t.TempDir(), uid, gid, groups, os.Environ(), nil, stdout, stderr)
+	fork.limits = newExecSpec(service, argv[0], argv)
+
+	prc, err := fork.exec(argv[0], argv)
+	if err != nil {
+		return "", err
+	}
+	if _, err := prc.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	<-stdout.closed
+	<-stderr.closed
+	if stderr.Len() > 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+func TestLimitsReachChildren(t *testing.T) {
+	nice, oom := 7, 300
+	service := models.Service{
+		Name:        "limited",
+		Limits:      map[string]string{"nofile": "123:456", "core": "0"},
+		Nice:        &nice,
+		OOMScoreAdj: &oom,
+		CPUAffinity: []int{0},
+	}
+
+	// Every value is read by a child of the shell, which must have inherited it
+	out, err := runLimited(t, service, `
+		sh -c 'ulimit -Sn'
+		sh -c 'ulimit -Hn'
+		sh -c 'ulimit -c'
+		cat /proc/self/oom_score_adj
+		awk '{ print $19 }' /proc/self/stat
+		grep Cpus_allowed_list /proc/self/status | cut -f2
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"123", "456", "0", "300", "7", "0"}
+	got := strings.Fields(out)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want nofile, hard nofile, core, oom_score_adj, nice and cpus %v", got, want)
+	}
+}
+
+func TestLimitsErrorFailsStart(t *testing.T) {
+	service := models.Service{
+		Name:   "limited",
+		Limits: map[string]string{"bogus": "1"},
+	}
+
+	_, err := runLimited(t, service, "echo started")
+	if err == nil || !strings.Contains(err.Error(), "bogus is not supported") {
+		t.Errorf("got error %v, want the error of the exec helper", err)
+	}
+}
+
+func TestLimitsDropCredentials(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root")
+	}
+
+	service := models.Service{
+		Name:       "limited",
+		Limits:     map[string]string{"nofile": "64"},
+		Credential: &models.Credential{UID: 65534, GID: 65534, Groups: []uint32{}},
+	}
+	out, err := runLimited(t, service, "id -u; id -g; id -G; ulimit -n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(out); strings.Join(got, " ") != "65534 65534 65534 64" {
+		t.Errorf("got %v, want uid, gid, groups and nofile of the service", got)
+	}
+}
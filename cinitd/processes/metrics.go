@@ -0,0 +1,44 @@
+package processes
+
+import (
+	"sync/atomic"
+
+	"github.com/ulfox/cinit/cinitd/metrics"
+)
+
+// PoolMetrics returns the state of the process pool and of the services it runs
+func (d *ProcessOperator) PoolMetrics() metrics.Pool {
+	d.Lock()
+	defer d.Unlock()
+
+	pool := metrics.Pool{
+		Size:          len(d.processPool),
+		ZombiesReaped: atomic.LoadUint64(&d.zombiesReaped),
+		Services:      make([]metrics.Service, 0, len(d.processPool)),
+	}
+
+	for puid, j := range d.processPool {
+		if j.service.Name == "" {
+			continue
+		}
+
+		s := metrics.Service{
+			Name:      j.service.Name,
+			Instance:  instanceName(j.service),
+			StartTime: j.startTime,
+		}
+		if j.process != nil && j.exitTime == nil {
+			s.PID = j.process.Pid
+			s.Up = s.PID > 0
+		}
+		if j.exitTime != nil {
+			exitCode := j.exitCode
+			s.ExitCode = &exitCode
+		}
+		if rs := d.restarts[puid]; rs != nil {
+			s.Restarts = rs.count
+		}
+		pool.Services = append(pool.Services, s)
+	}
+	return pool
+}
@@ -0,0 +1,96 @@
+package processes
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	serviceSimple  = "simple"
+	serviceOneshot = "oneshot"
+)
+
+// ServiceTypes lists the supported service types. Simple services are expected to keep
+// running, oneshot services run once and are expected to exit with a success exit code
+func ServiceTypes() []string {
+	return []string{serviceSimple, serviceOneshot}
+}
+
+func isOneshot(service models.Service) bool {
+	return service.ServiceType == serviceOneshot
+}
+
+// succeeded reports whether the process of the handler exited with one of the success
+// exit codes of its service (0 by default)
+func (w *ProcessHandler) succeeded() bool {
+	codes := w.service.SuccessExitCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	if w.exitCode < 0 {
+		return false
+	}
+	for _, c := range codes {
+		if c == w.exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// oneshotStatus returns the status of a finished oneshot service
+func (w *ProcessHandler) oneshotStatus() string {
+	if w.succeeded() {
+		return "completed"
+	}
+	return "failed"
+}
+
+// oneshotFinished is called when a oneshot service has exited and is not going to be
+// restarted. A failed service with abortOnFailure shuts cinitd down
+func (d *ProcessOperator) oneshotFinished(handler *ProcessHandler) {
+	service := handler.service
+	if !isOneshot(service) {
+		return
+	}
+
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Supervisor",
+		"Name":      instanceName(service),
+	})
+
+	d.Lock()
+	current := d.processPool[service.SUID] == handler && !handler.superseded
+	stopped := d.restarts[service.SUID] != nil && d.restarts[service.SUID].stopped
+	d.Unlock()
+	if !current {
+		return
+	}
+
+	if handler.succeeded() {
+		log.Infof("Oneshot service completed: %s", handler.exitStatus)
+		return
+	}
+	log.Errorf("Oneshot service failed: %s", handler.exitStatus)
+
+	if !service.AbortOnFailure || stopped || !d.allowPoolExpanding {
+		return
+	}
+
+	log.Error("Oneshot service has abortOnFailure set. Shutting down cinitd")
+	d.Lock()
+	d.aborted = true
+	d.Unlock()
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+}
+
+// Aborted reports whether cinitd has been shut down by a failed oneshot service
+func (d *ProcessOperator) Aborted() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.aborted
+}
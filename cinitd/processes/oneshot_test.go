@@ -0,0 +1,135 @@
+package processes
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func TestOneshotStatus(t *testing.T) {
+	tests := []struct {
+		codes    []int
+		exitCode int
+		status   string
+	}{
+		{exitCode: 0, status: "completed"},
+		{exitCode: 1, status: "failed"},
+		// Killed by a signal
+		{exitCode: -1, status: "failed"},
+		{codes: []int{0, 3}, exitCode: 3, status: "completed"},
+		{codes: []int{3}, exitCode: 0, status: "failed"},
+		{codes: []int{0, 3}, exitCode: -1, status: "failed"},
+	}
+	for _, tt := range tests {
+		w := &ProcessHandler{
+			service:  models.Service{ServiceType: serviceOneshot, SuccessExitCodes: tt.codes},
+			exitCode: tt.exitCode,
+		}
+		if got := w.oneshotStatus(); got != tt.status {
+			t.Errorf("exit code %d, success exit codes %v: got %s, want %s", tt.exitCode, tt.codes, got, tt.status)
+		}
+		if w.succeeded() != (tt.status == "completed") {
+			t.Errorf("exit code %d, success exit codes %v: succeeded %v", tt.exitCode, tt.codes, w.succeeded())
+		}
+	}
+}
+
+func TestOneshotFinished(t *testing.T) {
+	// cinitd is shut down with SIGTERM when it aborts
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM)
+	defer signal.Stop(sigterm)
+
+	tests := []struct {
+		name        string
+		service     models.Service
+		exitCode    int
+		stopped     bool
+		superseded  bool
+		notInPool   bool
+		shutdown    bool
+		wantAborted bool
+	}{
+		{
+			name:        "failed with abortOnFailure",
+			service:     models.Service{ServiceType: serviceOneshot, AbortOnFailure: true},
+			exitCode:    1,
+			wantAborted: true,
+		},
+		{
+			name:     "completed with abortOnFailure",
+			service:  models.Service{ServiceType: serviceOneshot, AbortOnFailure: true, SuccessExitCodes: []int{0, 1}},
+			exitCode: 1,
+		},
+		{
+			name:     "failed without abortOnFailure",
+			service:  models.Service{ServiceType: serviceOneshot},
+			exitCode: 1,
+		},
+		{
+			name:     "simple service with abortOnFailure",
+			service:  models.Service{AbortOnFailure: true},
+			exitCode: 1,
+		},
+		{
+			name:     "stopped on request",
+			service:  models.Service{ServiceType: serviceOneshot, AbortOnFailure: true},
+			exitCode: -1,
+			stopped:  true,
+		},
+		{
+			name:     "cinitd is shutting down",
+			service:  models.Service{ServiceType: serviceOneshot, AbortOnFailure: true},
+			exitCode: -1,
+			shutdown: true,
+		},
+		{
+			name:       "superseded by a restart",
+			service:    models.Service{ServiceType: serviceOneshot, AbortOnFailure: true},
+			exitCode:   1,
+			superseded: true,
+		},
+		{
+			name:      "deleted",
+			service:   models.Service{ServiceType: serviceOneshot, AbortOnFailure: true},
+			exitCode:  1,
+			notInPool: true,
+		},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		d.allowPoolExpanding = !tt.shutdown
+		tt.service.Name, tt.service.SUID = "migrate", "migrate"
+		handler := &ProcessHandler{
+			service:    tt.service,
+			exitCode:   tt.exitCode,
+			exitStatus: "exit status 1",
+			superseded: tt.superseded,
+			lock:       d,
+		}
+		d.processPool = map[string]*ProcessHandler{}
+		if !tt.notInPool {
+			d.processPool["migrate"] = handler
+		}
+		d.markStopped("migrate", tt.stopped)
+
+		d.oneshotFinished(handler)
+		if d.Aborted() != tt.wantAborted {
+			t.Errorf("%s: aborted %v, want %v", tt.name, d.Aborted(), tt.wantAborted)
+		}
+		select {
+		case <-sigterm:
+			if !tt.wantAborted {
+				t.Errorf("%s: cinitd was shut down", tt.name)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if tt.wantAborted {
+				t.Errorf("%s: cinitd was not shut down", tt.name)
+			}
+		}
+	}
+}
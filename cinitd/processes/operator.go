@@ -6,13 +6,18 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/cgroups"
 	"github.com/ulfox/cinit/cinitd/channels"
 	e "github.com/ulfox/cinit/cinitd/errors"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/logs"
 )
 
 type erf = func(e interface{}, p ...interface{}) error
@@ -31,26 +36,44 @@ type ProcessOperator struct {
 	base               chan chan *Task
 	task               chan *Task
 	exitPO             <-chan bool
+	stopping           chan bool
 	ready              chan bool
+	restarts           map[string]*restartState
+	reaper             *reaper
+	aborted            bool
+	schedules          map[string]*scheduleState
+	replicas           map[string]*replicaSet
+	timers             *channels.Timer
+	cgroups            *cgroups.Manager
 	serviceChan        *channels.Service
 	allowPoolExpanding bool
 	watchAll           bool
-	serviceLogDir      string
+	logs               *logs.Manager
+	events             *events.Bus
+	zombiesReaped      uint64
 }
 
 // NewProcessOperator creates, and returns a new ProcessOperator
-func NewProcessOperator(exitPO <-chan bool, logger *logrus.Logger, watchAll bool, serviceChan *channels.Service, serviceLogDir string) *ProcessOperator {
+func NewProcessOperator(exitPO <-chan bool, logger *logrus.Logger, watchAll bool, serviceChan *channels.Service, logManager *logs.Manager, cgroupManager *cgroups.Manager, eventBus *events.Bus) *ProcessOperator {
 	return &ProcessOperator{
 		logger:             logger,
 		task:               make(chan *Task),
 		base:               make(chan chan *Task),
 		processPool:        make(map[string]*ProcessHandler),
+		restarts:           make(map[string]*restartState),
+		schedules:          make(map[string]*scheduleState),
+		replicas:           make(map[string]*replicaSet),
+		timers:             channels.NewTimerChannel(),
+		cgroups:            cgroupManager,
+		reaper:             newReaper(),
 		ready:              make(chan bool),
+		stopping:           make(chan bool),
 		serviceChan:        serviceChan,
 		exitPO:             exitPO,
 		allowPoolExpanding: true,
 		watchAll:           watchAll,
-		serviceLogDir:      serviceLogDir,
+		logs:               logManager,
+		events:             eventBus,
 	}
 }
 
@@ -76,7 +99,10 @@ func (d *ProcessOperator) expandForbid(wg *sync.WaitGroup) {
 		"Part":      "ProcessQueue",
 	})
 
+	d.Lock()
 	d.allowPoolExpanding = false
+	d.Unlock()
+	d.cancelRestarts()
 	log.Warn("ProcessQueue expansion is now forbidden")
 	var sigTermProcesses sync.WaitGroup
 	sigTermProcesses.Add(1)
@@ -145,41 +171,15 @@ func (d *ProcessOperator) terminateProcesses(wg *sync.WaitGroup) {
 	})
 
 	d.Lock()
-	for _, j := range d.processPool {
-		j.process.Signal(syscall.SIGTERM)
-	}
+	layers := d.shutdownOrder()
 	d.Unlock()
 
+	for _, layer := range layers {
+		d.stopLayer(layer)
+	}
+
 	if !d.watchAll {
-		var notTerminated int
-		d.Lock()
-		if len(d.processPool) == 0 {
-			return
-		}
-		d.Unlock()
-
-		for {
-			select {
-			case <-time.After(60 * time.Second):
-				for _, j := range d.processPool {
-					j.process.Signal(syscall.SIGKILL)
-				}
-				return
-			default:
-				notTerminated = 0
-
-				d.Lock()
-				for _, k := range d.processPool {
-					if k.exitTime == nil {
-						notTerminated++
-					}
-				}
-				d.Unlock()
-				if notTerminated == 0 {
-					return
-				}
-			}
-		}
+		return
 	}
 
 	var sigTerm sync.WaitGroup
@@ -214,12 +214,11 @@ func (d *ProcessOperator) issueTask(task *Task, wg *sync.WaitGroup) {
 		"Component": "ProcessPoolManager",
 		"Part":      "Binding",
 	}).Debug("Received task. Pushing to next available process handler")
-	wg.Add(1)
-	go func(waitgroup *sync.WaitGroup) {
-		bindAvailableProcess := <-d.base
-		bindAvailableProcess <- task
-		waitgroup.Done()
-	}(wg)
+
+	// Tasks are bound one at a time, so the next available handler is the one that has
+	// been created for this task and the pool entry of its PUID runs this task
+	bindAvailableProcess := <-d.base
+	bindAvailableProcess <- task
 	wg.Done()
 }
 
@@ -234,6 +233,10 @@ func (d *ProcessOperator) addProcessHandler(puid string) {
 		d.base,
 		d.logger,
 	)
+	process.reaper = d.reaper
+	process.lock = d
+	process.onUnhealthy = d.livenessRestart
+	process.events = d.events
 
 	go process.listenForTask()
 
@@ -259,31 +262,84 @@ func (d *ProcessOperator) addProcessHandler(puid string) {
 
 	process.done <- true
 
-	if d.processPool[puid] != nil {
-		d.Lock()
-		if d.processPool[puid].process.Pid > 0 {
-			d.processPool[puid].process.Signal(syscall.SIGKILL)
-			d.processPool[puid].process.Wait()
-			d.processPool[puid].process = &os.Process{Pid: -1}
-		}
-		d.Unlock()
+	d.Lock()
+	if d.processPool[puid] == process && process.exitTime == nil && process.process.Pid > 0 {
+		process.process.Signal(syscall.SIGKILL)
+		process.process.Wait()
+		process.process = &os.Process{Pid: -1}
 	}
+	d.Unlock()
 
 	<-process.done
 	process.Close()
+
+	d.scheduledRunFinished(process)
+	if !d.scheduleRestart(process) {
+		d.oneshotFinished(process)
+	}
 }
 
-func (d *ProcessOperator) zKill(ctx context.Context, wg *sync.WaitGroup) {
-	for {
-		wpid, _ := syscall.Wait4(-1, &wstatus, syscall.WNOHANG, nil)
+// zombieChildren returns the pids of cinitd children that have exited but have not been
+// reaped yet
+func zombieChildren() []int {
+	zombies := make([]int, 0)
 
-		if wpid > 0 {
+	procFS, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return zombies
+	}
+
+	cinitdPID := os.Getpid()
+	for _, e := range procFS {
+		p, err := strconv.Atoi(e.Name())
+		if err != nil {
 			continue
 		}
 
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", p))
+		if err != nil {
+			continue
+		}
+
+		// The command name may contain spaces, fields are parsed after its closing bracket
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 || fields[0] != "Z" {
+			continue
+		}
+		if ppid, err := strconv.Atoi(fields[1]); err != nil || ppid != cinitdPID {
+			continue
+		}
+		zombies = append(zombies, p)
+	}
+	return zombies
+}
+
+// reapZombies waits for exited children that are not waited for by the goroutine that
+// started them, so that the exit status of services and commands is not lost
+func (d *ProcessOperator) reapZombies() {
+	d.reaper.Lock()
+	defer d.reaper.Unlock()
+	for _, pid := range zombieChildren() {
+		if d.reaper.isWaited(pid) {
+			continue
+		}
+		if reaped, _ := syscall.Wait4(pid, &wstatus, syscall.WNOHANG, nil); reaped > 0 {
+			atomic.AddUint64(&d.zombiesReaped, 1)
+		}
+	}
+}
+
+func (d *ProcessOperator) zKill(ctx context.Context, wg *sync.WaitGroup) {
+	for {
+		d.reapZombies()
+
 		select {
 		case <-ctx.Done():
-			_, _ = syscall.Wait4(-1, &wstatus, syscall.WNOHANG, nil)
+			d.reapZombies()
 			wg.Done()
 			d.logger.WithFields(logrus.Fields{
 				"Component": "ProcessPoolManager",
@@ -298,7 +354,7 @@ func (d *ProcessOperator) zKill(ctx context.Context, wg *sync.WaitGroup) {
 
 // Init ProcessOperator to listen for new tasks
 func (d *ProcessOperator) Init(wg *sync.WaitGroup) {
-	var zKillWG, taskListenerWG, taskOperatorWG, expandForbidWG, issueTaskWG, processPoolWG sync.WaitGroup
+	var zKillWG, taskListenerWG, taskOperatorWG, timerOperatorWG, expandForbidWG, issueTaskWG, processPoolWG sync.WaitGroup
 
 	ctxZKill, cancelZKILL := context.WithCancel(context.Background())
 	zKillWG.Add(1)
@@ -312,6 +368,10 @@ func (d *ProcessOperator) Init(wg *sync.WaitGroup) {
 	taskOperatorWG.Add(1)
 	go d.taskOperator(ctxTaskOperator, d.task, d.serviceChan, &taskOperatorWG)
 
+	ctxTimerOperator, cancelTimerOperator := context.WithCancel(context.Background())
+	timerOperatorWG.Add(1)
+	go d.timerOperator(ctxTimerOperator, &timerOperatorWG)
+
 	wg.Add(1)
 	d.ready <- true
 	for {
@@ -325,18 +385,24 @@ func (d *ProcessOperator) Init(wg *sync.WaitGroup) {
 				d.issueTask(task, &issueTaskWG)
 			}
 		case <-d.exitPO:
+			close(d.stopping)
+
 			cancelTaskListener()
 			taskListenerWG.Wait()
 
 			cancelTaskOperator()
 			taskOperatorWG.Wait()
 
+			cancelTimerOperator()
+			timerOperatorWG.Wait()
+
 			expandForbidWG.Add(1)
 			d.expandForbid(&expandForbidWG)
 
 			issueTaskWG.Wait()
 			processPoolWG.Wait()
 			expandForbidWG.Wait()
+			d.logs.Close()
 
 			cancelZKILL()
 			zKillWG.Wait()
@@ -1,17 +1,22 @@
 package processes
 
 import (
+	"context"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/models"
 )
 
 // Task we define the body of the process we want to fork
 type Task struct {
-	suid, Name  string
-	processInfo map[string][]string
-	Exec        func() (*os.Process, error)
+	suid, Name string
+	service    models.Service
+	argv       []string
+	Exec       func() (*os.Process, error)
 }
 
 // ProcessHandler for executing processes
@@ -22,12 +27,23 @@ type ProcessHandler struct {
 	base         chan chan *Task
 	done         chan bool
 	finishedTask chan bool
-	processInfo  map[string][]string
+	service      models.Service
 	logger       *logrus.Logger
+	events       *events.Bus
 	startTime    *time.Time
 	exitTime     *time.Time
 	err          error
 	exitStatus   string
+	exitCode     int
+	health       *healthMonitor
+	reaper       *reaper
+	onUnhealthy  func(*ProcessHandler, string)
+	superseded   bool
+	stopResult   string
+	argv         []string
+
+	// lock is the lock of the ProcessOperator, which guards the state of the handler
+	lock sync.Locker
 }
 
 // NewProcessHandler creates a new ProcessHandler. Essentially it creates a new Task and
@@ -56,22 +72,39 @@ func (w *ProcessHandler) listenForTask() {
 	for {
 		select {
 		case task := <-w.task:
-			w.processInfo = task.processInfo
-			prc, err := task.Exec()
+			w.lock.Lock()
+			w.service = task.service
+			w.lock.Unlock()
+			// The process is registered with the reaper before the zombie reaper can
+			// collect its exit status
+			prc, err := w.reaper.start(task.Exec)
 			startTime := time.Now()
-			w.startTime = &startTime
-			w.process = prc
 			if err != nil {
 				w.logger.WithFields(logrus.Fields{
 					"Component": "ProcessHandler",
 					"Part":      "Fork",
 				}).Error(err)
+				w.lock.Lock()
+				w.argv = task.argv
 				w.err = err
+				w.exitCode = -1
 				exitTime := time.Now()
 				w.exitTime = &exitTime
+				w.process = prc
+				w.startTime = &startTime
+				w.lock.Unlock()
+				w.publish(events.Event{
+					Type:   events.Failed,
+					Reason: err.Error(),
+				})
 				w.finishedTask <- true
 				break
 			}
+			w.lock.Lock()
+			w.argv = task.argv
+			w.process = prc
+			w.startTime = &startTime
+			w.lock.Unlock()
 
 			w.logger.WithFields(logrus.Fields{
 				"Component": "ProcessHandler",
@@ -81,10 +114,24 @@ func (w *ProcessHandler) listenForTask() {
 				"PID":       prc.Pid,
 			},
 			).Info("Task is being executed")
+			w.publish(events.Event{
+				Type: events.Started,
+				PID:  prc.Pid,
+			})
+
+			healthCtx, healthCancel := context.WithCancel(context.Background())
+			if task.service.HealthCheck != nil {
+				w.lock.Lock()
+				w.health = newHealthMonitor()
+				w.lock.Unlock()
+				go w.monitorHealth(healthCtx, startTime)
+			}
 
 			// We are not releasing. Essentially we are not forking but spawning childrens
 			// at the moment
 			exit, err := prc.Wait()
+			w.reaper.release(prc.Pid)
+			healthCancel()
 			if err != nil {
 				w.logger.WithFields(logrus.Fields{
 					"Component": "ProcessHandler",
@@ -100,10 +147,23 @@ func (w *ProcessHandler) listenForTask() {
 					"Name":      task.Name,
 				}).Infof("Task has finished: %s", exit)
 			}
+			exitCode := -1
+			if exit != nil {
+				exitCode = exit.ExitCode()
+			}
 			exitTime := time.Now()
+			w.lock.Lock()
 			w.exitTime = &exitTime
 			w.err = err
 			w.exitStatus = exit.String()
+			w.exitCode = exitCode
+			w.lock.Unlock()
+			w.publish(events.Event{
+				Type:       events.Exited,
+				PID:        prc.Pid,
+				ExitStatus: w.exitStatus,
+				ExitCode:   &exitCode,
+			})
 			w.finishedTask <- true
 		case <-w.done:
 			w.done <- true
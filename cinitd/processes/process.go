@@ -1,119 +1,197 @@
 package processes
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"strings"
 	"syscall"
+
+	"github.com/ulfox/cinit/cinitd/models"
 )
 
 type process struct {
-	stdout, stderr                   *os.File
-	uid, gid                         uint32
-	processDir, taskID, logDir, name string
-	process                          *os.Process
+	stdout, stderr     io.WriteCloser
+	uid, gid           uint32
+	groups             []uint32
+	processDir, taskID string
+	env                []string
+	cgroup             *os.File
+	limits             *execSpec
+	process            *os.Process
 }
 
-func newProcessFactory(taskID, logDir, dir, name string, uid, gid uint32) *process {
+// newProcessFactory returns a process that starts with the given credentials, environment
+// and outputs. If cgroup is not nil, the process starts inside that cgroup directory
+func newProcessFactory(taskID, dir string, uid, gid uint32, groups []uint32, env []string, cgroup *os.File, stdout, stderr io.WriteCloser) *process {
 	return &process{
 		taskID:     taskID,
-		logDir:     logDir,
 		uid:        uid,
 		gid:        gid,
+		groups:     groups,
 		processDir: dir,
-		name:       name,
+		env:        env,
+		cgroup:     cgroup,
+		stdout:     stdout,
+		stderr:     stderr,
+	}
+}
+
+// serviceCredential returns the uid, gid and supplementary groups a service runs with.
+// A nil groups slice means the groups of cinitd are kept
+func serviceCredential(service models.Service) (uint32, uint32, []uint32) {
+	if service.Credential == nil {
+		return uint32(os.Getuid()), uint32(os.Getgid()), nil
 	}
+	return service.Credential.UID, service.Credential.GID, service.Credential.Groups
 }
 
+// serviceDir returns the working directory of a service
+func serviceDir(service models.Service) string {
+	if service.WorkingDir != "" {
+		return service.WorkingDir
+	}
+	return "/"
+}
+
+// exec starts the process with its stdout and stderr connected to pipes. The output is
+// copied to the writers of the process until every process holding the pipes has exited.
+// If limits is set, the process starts as the exec helper, which applies them and
+// executes path with args. The writers are closed if the process can not be started
 func (p *process) exec(path string, args []string) (*os.Process, error) {
-	err := p.makeDirs(p.logDir, 0760)
+	started := false
+	defer func() {
+		if !started {
+			p.stdout.Close()
+			p.stderr.Close()
+		}
+	}()
+
+	stdoutR, stdoutW, err := os.Pipe()
 	if err != nil {
 		return &os.Process{
 			Pid: -1,
 		}, wrapErr(err)
 	}
 
-	p.stdout, err = os.OpenFile(
-		fmt.Sprintf("%s/%s-out.log", p.logDir, p.name),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
-		0666,
-	)
+	stderrR, stderrW, err := os.Pipe()
 	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
 		return &os.Process{
 			Pid: -1,
 		}, wrapErr(err)
 	}
 
-	p.stderr, err = os.OpenFile(
-		fmt.Sprintf("%s/%s-err.log", p.logDir, p.name),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
-		0666,
-	)
-	if err != nil {
-		return &os.Process{
-			Pid: -1,
-		}, wrapErr(err)
+	// The child holds its own copies of the write ends
+	defer stdoutW.Close()
+	defer stderrW.Close()
+
+	files := []*os.File{
+		nil,
+		stdoutW,
+		stderrW,
 	}
+	sys := &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:         p.uid,
+			Gid:         p.gid,
+			Groups:      p.groups,
+			NoSetGroups: p.groups == nil,
+		},
+		Setsid: true,
+	}
+
+	var statusR *os.File
+	if p.limits != nil {
+		spec, err := json.Marshal(p.limits)
+		if err != nil {
+			stdoutR.Close()
+			stderrR.Close()
+			return &os.Process{
+				Pid: -1,
+			}, wrapErr(err)
+		}
+		var statusW *os.File
+		statusR, statusW, err = os.Pipe()
+		if err != nil {
+			stdoutR.Close()
+			stderrR.Close()
+			return &os.Process{
+				Pid: -1,
+			}, wrapErr(err)
+		}
+		defer statusR.Close()
+		defer statusW.Close()
 
-	defer p.stdout.Close()
-	defer p.stderr.Close()
+		// The helper keeps the privileges of cinitd until the limits are set
+		path, args = "/proc/self/exe", []string{execHelperName, string(spec)}
+		files = append(files, statusW)
+		sys.Credential = nil
+	}
 
-	if err != nil {
-		return &os.Process{
-			Pid: -1,
-		}, wrapErr(err)
+	// The process is cloned into its cgroup (clone3 with CLONE_INTO_CGROUP), so that
+	// nothing it runs escapes the limits of the cgroup
+	if p.cgroup != nil {
+		sys.UseCgroupFD = true
+		sys.CgroupFD = int(p.cgroup.Fd())
 	}
+
 	prc, err := os.StartProcess(
 		path,
 		args,
 		&os.ProcAttr{
-			Dir: p.processDir,
-			Env: os.Environ(),
-			Files: []*os.File{
-				nil,
-				p.stdout,
-				p.stderr,
-			},
-			Sys: &syscall.SysProcAttr{
-				Credential: &syscall.Credential{
-					Uid:         p.uid,
-					Gid:         p.gid,
-					Groups:      nil,
-					NoSetGroups: true,
-				},
-				Setsid: true,
-			},
+			Dir:   p.processDir,
+			Env:   p.env,
+			Files: files,
+			Sys:   sys,
 		},
 	)
 	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
 		return prc, wrapErr(err)
 	}
+
+	if statusR != nil {
+		if err := helperStatus(prc, files[execHelperStatusFd], statusR); err != nil {
+			stdoutR.Close()
+			stderrR.Close()
+			return &os.Process{
+				Pid: -1,
+			}, err
+		}
+	}
+
+	started = true
+	go copyOutput(p.stdout, stdoutR)
+	go copyOutput(p.stderr, stderrR)
+
 	p.process = prc
 	return prc, nil
 }
 
-func (p *process) makeDirs(path string, m os.FileMode) error {
-	if path == "/" {
+// helperStatus waits for the exec helper to execute the command of the service. The
+// helper writes an error to the status pipe, or execs and so closes its end of it
+func helperStatus(prc *os.Process, statusW, statusR *os.File) error {
+	statusW.Close()
+	msg, err := ioutil.ReadAll(statusR)
+	if err != nil {
+		msg = []byte(err.Error())
+	}
+	if len(msg) == 0 {
 		return nil
 	}
 
-	f, err := os.Stat(path)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return wrapErr(err)
-		}
-	} else {
-		if f.IsDir() {
-			return nil
-		}
-	}
+	prc.Kill()
+	prc.Wait()
+	return fmt.Errorf("%s", msg)
+}
 
-	path = strings.TrimSuffix(path, "/")
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err = os.MkdirAll(path, m)
-		if err != nil {
-			return wrapErr(err)
-		}
-	}
-	return nil
+// copyOutput copies the output of a process from the read end of its pipe until EOF
+func copyOutput(w io.WriteCloser, r *os.File) {
+	defer r.Close()
+	defer w.Close()
+	io.Copy(w, r)
 }
@@ -0,0 +1,72 @@
+package processes
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExecClosesOutputsOnError(t *testing.T) {
+	tests := []struct {
+		name, path, dir string
+	}{
+		{name: "missing command", path: "/nonexistent/command", dir: "/"},
+		{name: "missing dir", path: "/bin/true", dir: "/nonexistent"},
+	}
+	for _, tt := range tests {
+		stdout, stderr := newCaptureWriter(), newCaptureWriter()
+		p := newProcessFactory("test", tt.dir, uint32(os.Getuid()), uint32(os.Getgid()), nil, nil, nil, stdout, stderr)
+		if _, err := p.exec(tt.path, []string{tt.path}); err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		for _, w := range []*captureWriter{stdout, stderr} {
+			select {
+			case <-w.closed:
+			case <-time.After(time.Second):
+				t.Errorf("%s: output was not closed", tt.name)
+			}
+		}
+	}
+}
+
+func TestReapZombiesKeepsExitStatus(t *testing.T) {
+	d := &ProcessOperator{reaper: newReaper()}
+
+	// The service exits before anyone waits for it
+	prc, err := d.reaper.start(func() (*os.Process, error) {
+		return os.StartProcess("/bin/sh", []string{"sh", "-c", "exit 3"}, &os.ProcAttr{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !isZombie(prc.Pid) {
+		if time.Now().After(deadline) {
+			t.Fatal("service did not exit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.reapZombies()
+
+	state, err := prc.Wait()
+	d.reaper.release(prc.Pid)
+	if err != nil {
+		t.Fatalf("exit status was reaped: %s", err)
+	}
+	if state.ExitCode() != 3 {
+		t.Errorf("exit code %d, want 3", state.ExitCode())
+	}
+	if d.reaper.isWaited(prc.Pid) {
+		t.Error("service is still registered after it was waited for")
+	}
+}
+
+func isZombie(pid int) bool {
+	for _, z := range zombieChildren() {
+		if z == pid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package processes
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// reaper keeps the zombie reaper away from children of cinitd whose exit status is
+// collected by the goroutine that started them, like services, health check and reload
+// commands. The zombie reaper holds the write lock while it collects exit statuses
+type reaper struct {
+	sync.RWMutex
+	waitedMu sync.Mutex
+	waited   map[int]bool
+}
+
+func newReaper() *reaper {
+	return &reaper{
+		waited: make(map[int]bool),
+	}
+}
+
+// start calls startProcess and registers the process it started as waited. The lock is
+// only held until then, so that a child exiting right away can not be reaped before it
+// is registered. The caller waits for the process and then releases it
+func (r *reaper) start(startProcess func() (*os.Process, error)) (*os.Process, error) {
+	r.RLock()
+	defer r.RUnlock()
+	prc, err := startProcess()
+	if err != nil {
+		return prc, err
+	}
+	r.waitedMu.Lock()
+	r.waited[prc.Pid] = true
+	r.waitedMu.Unlock()
+	return prc, nil
+}
+
+// release hands pid back to the zombie reaper after its exit status was collected
+func (r *reaper) release(pid int) {
+	r.waitedMu.Lock()
+	delete(r.waited, pid)
+	r.waitedMu.Unlock()
+}
+
+// run starts cmd and waits for it
+func (r *reaper) run(cmd *exec.Cmd) error {
+	prc, err := r.start(func() (*os.Process, error) {
+		err := cmd.Start()
+		return cmd.Process, err
+	})
+	if err != nil {
+		return err
+	}
+	err = cmd.Wait()
+	r.release(prc.Pid)
+	return err
+}
+
+// isWaited reports whether pid is waited for by the goroutine that started it
+func (r *reaper) isWaited(pid int) bool {
+	r.waitedMu.Lock()
+	defer r.waitedMu.Unlock()
+	return r.waited[pid]
+}
@@ -0,0 +1,86 @@
+package processes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/utils"
+	"golang.org/x/sys/unix"
+)
+
+// reloadTimeout is how long a reload command may run
+const reloadTimeout = 30 * time.Second
+
+// signalAction handles the reload and signal actions. A reload runs the reload command of
+// the service, or sends its reload signal (default SIGHUP). A signal action sends the
+// requested signal to the process of the service, or to its process group. The outcome
+// is reported in the message of the action
+func (d *ProcessOperator) signalAction(sa *models.ServiceAction) {
+	d.Lock()
+	handler := d.processPool[sa.SUID]
+	running := handler != nil && handler.startTime != nil && handler.exitTime == nil
+	var service models.Service
+	if running {
+		service = handler.service
+	}
+	d.Unlock()
+
+	if !running {
+		sa.Message = fmt.Sprintf("can not %s service: not running", sa.T)
+		return
+	}
+
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Signal",
+		"Name":      instanceName(service),
+	})
+
+	if sa.T == "reload" && len(service.ReloadCommand) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+
+		log.Infof("Running reload command %s", strings.Join(service.ReloadCommand, " "))
+		if err := handler.runCommand(ctx, service.ReloadCommand); err != nil {
+			log.Errorf("Reload command failed: %s", err)
+			sa.Message = fmt.Sprintf("reload command failed: %s", err)
+			return
+		}
+		sa.Message = "reload command succeeded"
+		return
+	}
+
+	sig, group := syscall.SIGHUP, service.SignalProcessGroup
+	name := service.ReloadSignal
+	if sa.T == "signal" {
+		name = sa.Signal
+		group = group || sa.SignalGroup
+		if name == "" {
+			sa.Message = "signal can not be empty"
+			return
+		}
+	}
+	if name != "" {
+		s, err := utils.ParseSignal(name)
+		if err != nil {
+			sa.Message = err.Error()
+			return
+		}
+		sig = s
+	}
+
+	log.Infof("Sending %s", unix.SignalName(sig))
+	if err := handler.kill(sig, group); err != nil {
+		sa.Message = fmt.Sprintf("could not send %s: %s", unix.SignalName(sig), err)
+		return
+	}
+	sa.Message = fmt.Sprintf("sent %s", unix.SignalName(sig))
+	if group {
+		sa.Message = fmt.Sprintf("sent %s to the process group", unix.SignalName(sig))
+	}
+}
@@ -0,0 +1,203 @@
+package processes
+
+import (
+	"bufio"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// readLines reads n lines of the output of a test handler and returns them sorted
+func readLines(t *testing.T, out *bufio.Reader, n int) []string {
+	t.Helper()
+	lines := make(chan string)
+	go func() {
+		for i := 0; i < n; i++ {
+			line, err := out.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+
+	var got []string
+	for len(got) < n {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("read %q, want %d lines", got, n)
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestSignalAction(t *testing.T) {
+	const (
+		waitForSignals = `echo ready; while :; do sleep 0.05; done`
+		trapAll        = `trap "echo hup" HUP; trap "echo usr1" USR1; trap "echo usr2" USR2; `
+		trapInGroup    = `trap "echo parent; exit" USR1; (trap "echo child; exit" USR1; ` + waitForSignals + `) & wait`
+	)
+	tests := []struct {
+		name    string
+		service models.Service
+		script  string
+		sa      models.ServiceAction
+		message string
+		output  []string
+	}{
+		{
+			name:    "reload with the default signal",
+			script:  trapAll + waitForSignals,
+			sa:      models.ServiceAction{T: "reload"},
+			message: "sent SIGHUP",
+			output:  []string{"hup"},
+		},
+		{
+			name:    "reload with reloadSignal",
+			service: models.Service{ReloadSignal: "usr1"},
+			script:  trapAll + waitForSignals,
+			sa:      models.ServiceAction{T: "reload"},
+			message: "sent SIGUSR1",
+			output:  []string{"usr1"},
+		},
+		{
+			name:    "reload the process group",
+			service: models.Service{ReloadSignal: "SIGUSR1", SignalProcessGroup: true},
+			script:  trapInGroup,
+			sa:      models.ServiceAction{T: "reload"},
+			message: "sent SIGUSR1 to the process group",
+			output:  []string{"child", "parent"},
+		},
+		{
+			name:    "signal",
+			script:  trapAll + waitForSignals,
+			sa:      models.ServiceAction{T: "signal", Signal: "SIGUSR2"},
+			message: "sent SIGUSR2",
+			output:  []string{"usr2"},
+		},
+		{
+			name:    "signal by number",
+			script:  trapAll + waitForSignals,
+			sa:      models.ServiceAction{T: "signal", Signal: "10"},
+			message: "sent SIGUSR1",
+			output:  []string{"usr1"},
+		},
+		{
+			name:    "signal the process group",
+			script:  trapInGroup,
+			sa:      models.ServiceAction{T: "signal", Signal: "USR1", SignalGroup: true},
+			message: "sent SIGUSR1 to the process group",
+			output:  []string{"child", "parent"},
+		},
+		{
+			name:    "signal the process only",
+			script:  trapInGroup,
+			sa:      models.ServiceAction{T: "signal", Signal: "USR1"},
+			message: "sent SIGUSR1",
+			output:  []string{"parent"},
+		},
+		{
+			name:    "empty signal",
+			script:  waitForSignals,
+			sa:      models.ServiceAction{T: "signal"},
+			message: "signal can not be empty",
+		},
+		{
+			name:    "unknown signal",
+			script:  waitForSignals,
+			sa:      models.ServiceAction{T: "signal", Signal: "SIGFOO"},
+			message: "signal SIGFOO does not exist",
+		},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		d.reaper = newReaper()
+		tt.service.Name, tt.service.SUID = "web", "web"
+		handler, out := startTestHandler(t, d, tt.service, tt.script)
+		d.processPool = map[string]*ProcessHandler{"web": handler}
+
+		sa := tt.sa
+		sa.Name, sa.SUID = "web", "web"
+		d.signalAction(&sa)
+		if sa.Message != tt.message {
+			t.Errorf("%s: got message %q, want %q", tt.name, sa.Message, tt.message)
+			continue
+		}
+		if got := readLines(t, out, len(tt.output)); strings.Join(got, ",") != strings.Join(tt.output, ",") {
+			t.Errorf("%s: service printed %q, want %q", tt.name, got, tt.output)
+		}
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		command []string
+		message string
+	}{
+		{
+			command: []string{"/bin/sh", "-c", `echo "$MODE" > ` + filepath.Join(dir, "reloaded")},
+			message: "reload command succeeded",
+		},
+		{
+			command: []string{"/bin/sh", "-c", "echo config is invalid; exit 2"},
+			message: "reload command failed: exit status 2: config is invalid",
+		},
+		{
+			command: []string{"/nonexistent/reload"},
+			message: "reload command failed: fork/exec /nonexistent/reload: no such file or directory",
+		},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		d.reaper = newReaper()
+		service := models.Service{Name: "web", SUID: "web", Env: map[string]string{"MODE": "prod"}, ReloadCommand: tt.command}
+		handler, out := startTestHandler(t, d, service, `trap "echo hup" HUP; trap "echo usr2" USR2; echo ready; while :; do sleep 0.05; done`)
+		d.processPool = map[string]*ProcessHandler{"web": handler}
+
+		sa := models.ServiceAction{T: "reload", Name: "web", SUID: "web"}
+		d.signalAction(&sa)
+		if sa.Message != tt.message {
+			t.Errorf("%v: got message %q, want %q", tt.command, sa.Message, tt.message)
+		}
+
+		// The reload command replaces the reload signal
+		handler.kill(syscall.SIGUSR2, false)
+		if got := readLines(t, out, 1); got[0] != "usr2" {
+			t.Errorf("%v: service printed %q before the test signal", tt.command, got)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "reloaded"))
+	if err != nil || string(data) != "prod\n" {
+		t.Errorf("reload command wrote %q, %v", data, err)
+	}
+}
+
+func TestSignalActionNotRunning(t *testing.T) {
+	d := newTestOperator()
+	now := time.Now()
+	d.processPool = map[string]*ProcessHandler{
+		"exited":  {lock: d, startTime: &now, exitTime: &now},
+		"waiting": {lock: d},
+	}
+	for _, sa := range []models.ServiceAction{
+		{T: "reload", SUID: "missing"},
+		{T: "reload", SUID: "exited"},
+		{T: "signal", SUID: "waiting", Signal: "SIGHUP"},
+	} {
+		d.signalAction(&sa)
+		if want := "can not " + sa.T + " service: not running"; sa.Message != want {
+			t.Errorf("%s: got message %q, want %q", sa.SUID, sa.Message, want)
+		}
+	}
+}
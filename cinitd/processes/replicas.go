@@ -0,0 +1,235 @@
+package processes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// replicaSet keeps track of a service with replicas. Every replica runs as an instance of
+// the service with its own PUID, <suid>-<index>, and is handled like a service of its own
+type replicaSet struct {
+	service models.Service
+	count   int
+}
+
+// replicaPUID returns the PUID of a replica
+func replicaPUID(suid string, index int) string {
+	return fmt.Sprintf("%s-%d", suid, index)
+}
+
+// instanceName returns the name used for the logs and the cgroup of a service. Replicas
+// get their index as suffix
+func instanceName(service models.Service) string {
+	if service.ReplicaOf == "" {
+		return service.Name
+	}
+	return fmt.Sprintf("%s-%d", service.Name, service.ReplicaIndex)
+}
+
+// replicaInstance returns the instance that runs a replica of a service
+func replicaInstance(service models.Service, index int) models.Service {
+	instance := service
+	instance.SUID = replicaPUID(service.SUID, index)
+	instance.ReplicaOf = service.SUID
+	instance.ReplicaIndex = index
+	return instance
+}
+
+func (d *ProcessOperator) replicaSet(suid string) *replicaSet {
+	d.Lock()
+	defer d.Unlock()
+	return d.replicas[suid]
+}
+
+// addReplicaSet registers a service with replicas and returns the instances to start.
+// Registering a service again returns no instances
+func (d *ProcessOperator) addReplicaSet(service models.Service) []models.Service {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.replicas[service.SUID] != nil {
+		return nil
+	}
+	d.replicas[service.SUID] = &replicaSet{
+		service: service,
+		count:   service.Replicas,
+	}
+
+	instances := make([]models.Service, 0, service.Replicas)
+	for i := 0; i < service.Replicas; i++ {
+		instances = append(instances, replicaInstance(service, i))
+	}
+	return instances
+}
+
+// replicaAction runs an action on every replica of a service and aggregates the outcome.
+// Restarts go through the replicas one at a time, other actions run on all of them at once
+func (d *ProcessOperator) replicaAction(sa models.ServiceAction, set *replicaSet, serviceChan *channels.Service, l *logrus.Entry) models.ServiceAction {
+	if sa.T == "scale" {
+		if err := d.scaleReplicas(set, sa.Replicas, serviceChan, l); err != nil {
+			sa.Message = err.Error()
+		}
+	}
+
+	d.Lock()
+	service, count := set.service, set.count
+	d.Unlock()
+
+	instances := make([]models.ServiceAction, count)
+	run := func(i int) {
+		ia := sa
+		ia.Message = ""
+		ia.SUID = replicaPUID(service.SUID, i)
+		ia.Name = fmt.Sprintf("%s-%d", service.Name, i)
+		if ia.T == "scale" {
+			ia.T = "status"
+		}
+		instances[i] = d.serviceAction(ia, serviceChan, l.WithField("Replica", i))
+	}
+
+	if sa.T == "restart" {
+		for i := range instances {
+			run(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := range instances {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	if sa.T == "delete" {
+		d.Lock()
+		delete(d.replicas, service.SUID)
+		d.Unlock()
+	}
+
+	return aggregateReplicas(sa, instances)
+}
+
+// scaleReplicas changes the number of replicas of a service. New replicas are started and
+// waited for, removed replicas are stopped and deleted starting from the highest index
+func (d *ProcessOperator) scaleReplicas(set *replicaSet, n int, serviceChan *channels.Service, l *logrus.Entry) error {
+	if n < 1 {
+		return fmt.Errorf("replicas must be at least 1")
+	}
+
+	d.Lock()
+	service, count := set.service, set.count
+	set.count = n
+	set.service.Replicas = n
+	d.Unlock()
+
+	if n == count {
+		return nil
+	}
+	l.Infof("Scaling from %d to %d replicas", count, n)
+
+	var wg sync.WaitGroup
+	for i := count; i < n; i++ {
+		instance := replicaInstance(service, i)
+		instance.T = "scale"
+		serviceChan.Push(instance)
+	}
+	for i := count; i < n; i++ {
+		wg.Add(1)
+		go func(puid string) {
+			defer wg.Done()
+			if _, err := d.waitStarted(puid, 5*time.Second); err != nil {
+				l.Errorf("Replica %s did not start: %s", puid, err)
+			}
+		}(replicaPUID(service.SUID, i))
+	}
+
+	for i := n; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d.serviceAction(models.ServiceAction{
+				T:    "delete",
+				SUID: replicaPUID(service.SUID, i),
+				Name: fmt.Sprintf("%s-%d", service.Name, i),
+			}, serviceChan, l.WithField("Replica", i))
+		}(i)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// aggregateReplicas combines the outcome of an action on the replicas of a service. The
+// service has the status of its replicas if they all agree, otherwise it is degraded
+func aggregateReplicas(sa models.ServiceAction, instances []models.ServiceAction) models.ServiceAction {
+	sa.Replicas = len(instances)
+	sa.Instances = make([]models.ReplicaStatus, 0, len(instances))
+
+	statuses := make(map[string]bool)
+	health := make(map[string]bool)
+	messages := make([]string, 0)
+	for i, j := range instances {
+		sa.Instances = append(sa.Instances, models.ReplicaStatus{
+			Index:      i,
+			PUID:       j.SUID,
+			PID:        j.PID,
+			Status:     j.Status,
+			Health:     j.Health,
+			StartTime:  j.StartTime,
+			ExitTime:   j.ExitTime,
+			ExitStatus: j.ExitStatus,
+			Restarts:   j.Restarts,
+		})
+
+		statuses[j.Status] = true
+		health[j.Health] = true
+		sa.Restarts += j.Restarts
+		if j.StartTime != nil && (sa.StartTime == nil || j.StartTime.Before(*sa.StartTime)) {
+			sa.StartTime = j.StartTime
+		}
+		if j.ExitTime != nil && (sa.ExitTime == nil || j.ExitTime.After(*sa.ExitTime)) {
+			sa.ExitTime = j.ExitTime
+		}
+		if sa.Error == nil {
+			sa.Error = j.Error
+		}
+		if j.Message != "" {
+			messages = append(messages, fmt.Sprintf("%s: %s", j.Name, j.Message))
+		}
+	}
+
+	sa.Status = "stopped"
+	if len(statuses) == 1 {
+		sa.Status = instances[0].Status
+	} else if len(statuses) > 1 {
+		sa.Status = "degraded"
+	}
+	if len(health) == 1 {
+		sa.Health = instances[0].Health
+	} else if len(health) > 1 {
+		sa.Health = "degraded"
+	}
+	if sa.Status == "running" {
+		sa.ExitTime = nil
+	}
+
+	if len(messages) > 0 {
+		sort.Strings(messages)
+		if sa.Message != "" {
+			messages = append([]string{sa.Message}, messages...)
+		}
+		sa.Message = strings.Join(messages, "; ")
+	}
+
+	return sa
+}
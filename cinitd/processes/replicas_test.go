@@ -0,0 +1,208 @@
+package processes
+
+import (
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func TestReplicaInstance(t *testing.T) {
+	service := models.Service{Name: "web", SUID: "1f0c", Replicas: 3}
+	tests := []struct {
+		service models.Service
+		puid    string
+		name    string
+		env     string
+	}{
+		{service: models.Service{Name: "web", SUID: "1f0c"}, puid: "1f0c", name: "web"},
+		{service: replicaInstance(service, 0), puid: "1f0c-0", name: "web-0", env: "CINIT_REPLICA_INDEX=0"},
+		{service: replicaInstance(service, 2), puid: "1f0c-2", name: "web-2", env: "CINIT_REPLICA_INDEX=2"},
+	}
+	for _, tt := range tests {
+		if tt.service.SUID != tt.puid || instanceName(tt.service) != tt.name {
+			t.Errorf("%s: got PUID %s, instance %s, want %s, %s", tt.name, tt.service.SUID, instanceName(tt.service), tt.puid, tt.name)
+		}
+		if tt.service.ReplicaOf != "" && tt.service.ReplicaOf != service.SUID {
+			t.Errorf("%s: replica of %s", tt.name, tt.service.ReplicaOf)
+		}
+
+		env, err := serviceEnv(tt.service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var index string
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "CINIT_REPLICA_INDEX=") {
+				index = kv
+			}
+		}
+		if index != tt.env {
+			t.Errorf("%s: got %q, want %q", tt.name, index, tt.env)
+		}
+	}
+}
+
+func TestAggregateReplicas(t *testing.T) {
+	started := time.Date(2021, 10, 17, 15, 0, 0, 0, time.UTC)
+	later := started.Add(time.Minute)
+	tests := []struct {
+		name      string
+		instances []models.ServiceAction
+		status    string
+		health    string
+		message   string
+	}{
+		{
+			name: "all running",
+			instances: []models.ServiceAction{
+				{Name: "web-0", Status: "running", Health: "healthy", StartTime: &later},
+				{Name: "web-1", Status: "running", Health: "healthy", StartTime: &started},
+			},
+			status: "running",
+			health: "healthy",
+		},
+		{
+			name: "one stopped",
+			instances: []models.ServiceAction{
+				{Name: "web-0", Status: "running"},
+				{Name: "web-1", Status: "stopped", Message: "stopped on request"},
+			},
+			status:  "degraded",
+			message: "web-1: stopped on request",
+		},
+		{
+			name: "one unhealthy",
+			instances: []models.ServiceAction{
+				{Name: "web-0", Status: "running", Health: "unhealthy", Message: "b"},
+				{Name: "web-1", Status: "running", Health: "healthy", Message: "a"},
+			},
+			status:  "running",
+			health:  "degraded",
+			message: "web-0: b; web-1: a",
+		},
+	}
+	for _, tt := range tests {
+		sa := aggregateReplicas(models.ServiceAction{T: "status", Name: "web"}, tt.instances)
+		if sa.Status != tt.status || sa.Health != tt.health || sa.Message != tt.message {
+			t.Errorf("%s: got %s, %s, %q, want %s, %s, %q", tt.name, sa.Status, sa.Health, sa.Message, tt.status, tt.health, tt.message)
+		}
+		if sa.Replicas != len(tt.instances) || len(sa.Instances) != len(tt.instances) {
+			t.Errorf("%s: %d replicas, %d instances", tt.name, sa.Replicas, len(sa.Instances))
+		}
+	}
+	sa := aggregateReplicas(models.ServiceAction{}, tests[0].instances)
+	if !sa.StartTime.Equal(started) || sa.ExitTime != nil {
+		t.Errorf("replicas started at %v, exited at %v", sa.StartTime, sa.ExitTime)
+	}
+}
+
+// runTestOperator runs a ProcessOperator that writes the logs of the services to a
+// temporary directory through the returned log manager
+func runTestOperator(t *testing.T) (*ProcessOperator, *channels.Service, *logs.Manager) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logManager := logs.NewManager(t.TempDir(), nil, logs.TargetFile, nil)
+	serviceChan := channels.NewServiceChannel(5, 5)
+
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	d := NewProcessOperator(stop, logger, false, serviceChan, logManager, nil, events.NewBus(100))
+	go d.Init(&wg)
+	d.Ready()
+	t.Cleanup(func() {
+		stop <- true
+		wg.Wait()
+	})
+	return d, serviceChan, logManager
+}
+
+// sendAction sends an action to the ProcessOperator and returns its outcome
+func sendAction(serviceChan *channels.Service, sa models.ServiceAction) models.ServiceAction {
+	siChan := make(chan models.ServiceAction)
+	serviceChan.PushSA(siChan)
+	siChan <- sa
+	return <-siChan
+}
+
+// waitLog waits for the stdout log of a service instance to be want
+func waitLog(t *testing.T, logManager *logs.Manager, name, want string) {
+	t.Helper()
+	var data []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		data, _ = ioutil.ReadFile(logManager.Path(name, logs.Stdout))
+		if string(data) == want {
+			return
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	t.Errorf("log of %s is %q, want %q", name, data, want)
+}
+
+func TestScaleReplicas(t *testing.T) {
+	_, serviceChan, logManager := runTestOperator(t)
+	serviceChan.Push(models.Service{
+		Name:     "web",
+		SUID:     "1f0c",
+		Command:  `echo "replica $CINIT_REPLICA_INDEX"; exec sleep 30`,
+		Shell:    true,
+		Replicas: 2,
+	})
+
+	status := func(want int) {
+		t.Helper()
+		var sa models.ServiceAction
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			sa = sendAction(serviceChan, models.ServiceAction{T: "status", Name: "web", SUID: "1f0c"})
+			if sa.Status == "running" && len(sa.Instances) == want {
+				break
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+		if sa.Status != "running" || sa.Replicas != want || len(sa.Instances) != want {
+			t.Fatalf("status %s with %d replicas, want running with %d: %+v", sa.Status, sa.Replicas, want, sa)
+		}
+		for i, j := range sa.Instances {
+			if j.Index != i || j.PUID != replicaPUID("1f0c", i) || j.PID == "" {
+				t.Errorf("instance %d is %+v", i, j)
+			}
+		}
+	}
+
+	status(2)
+	waitLog(t, logManager, "web-0", "replica 0\n")
+	waitLog(t, logManager, "web-1", "replica 1\n")
+
+	tests := []struct {
+		replicas int
+		message  string
+		want     int
+	}{
+		{replicas: 3, want: 3},
+		{replicas: 3, want: 3},
+		{replicas: 1, want: 1},
+		{replicas: 0, message: "replicas must be at least 1", want: 1},
+	}
+	for _, tt := range tests {
+		sa := sendAction(serviceChan, models.ServiceAction{T: "scale", Name: "web", SUID: "1f0c", Replicas: tt.replicas})
+		if sa.Message != tt.message {
+			t.Errorf("scale to %d: got message %q, want %q", tt.replicas, sa.Message, tt.message)
+		}
+		status(tt.want)
+	}
+	waitLog(t, logManager, "web-2", "replica 2\n")
+
+	// Removed replicas are deleted
+	sa := sendAction(serviceChan, models.ServiceAction{T: "status", Name: "web-2", SUID: "1f0c-2"})
+	if sa.Status != "stopped" || sa.PID != "" || sa.StartTime != nil {
+		t.Errorf("removed replica is %s with pid %q, started at %v", sa.Status, sa.PID, sa.StartTime)
+	}
+}
@@ -0,0 +1,306 @@
+package processes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	restartNo            = "no"
+	restartAlways        = "always"
+	restartOnFailure     = "on-failure"
+	restartUnlessStopped = "unless-stopped"
+
+	defaultRestartDelay    = time.Second
+	defaultRestartMaxDelay = time.Minute
+	defaultRestartWindow   = 10 * time.Minute
+	// defaultMaxRestarts is reached within the default window by a service that fails
+	// right after starting, at the default delays
+	defaultMaxRestarts = 10
+	// unlimitedRestarts is the maxRestarts of services that are restarted forever
+	unlimitedRestarts = -1
+
+	// restartRecords is the number of restart reasons kept per service
+	restartRecords = 10
+)
+
+// restartState keeps track of the restarts of a service across ProcessHandlers
+type restartState struct {
+	count       int
+	history     []time.Time
+	nextRestart *time.Time
+	stopped     bool
+	gaveUp      bool
+	timer       *time.Timer
+	records     []models.RestartRecord
+}
+
+// RestartPolicies lists the supported values of a service restart policy
+func RestartPolicies() []string {
+	return []string{restartNo, restartAlways, restartOnFailure, restartUnlessStopped}
+}
+
+func (d *ProcessOperator) restartStateFor(suid string) *restartState {
+	rs := d.restarts[suid]
+	if rs == nil {
+		rs = &restartState{}
+		d.restarts[suid] = rs
+	}
+	return rs
+}
+
+// markStopped records that a service has been stopped on request, so that its restart
+// policy does not bring it back, and cancels any scheduled restart. A service started on
+// request after its restart limits were reached gets a new window of restarts
+func (d *ProcessOperator) markStopped(suid string, stopped bool) {
+	d.Lock()
+	rs := d.restartStateFor(suid)
+	rs.stopped = stopped
+	if !stopped && rs.gaveUp {
+		rs.gaveUp = false
+		rs.history = nil
+	}
+	if rs.timer != nil {
+		rs.timer.Stop()
+		rs.timer = nil
+	}
+	rs.nextRestart = nil
+	d.Unlock()
+}
+
+// forgetRestarts removes the restart state of a deleted service
+func (d *ProcessOperator) forgetRestarts(suid string) {
+	d.Lock()
+	if rs := d.restarts[suid]; rs != nil && rs.timer != nil {
+		rs.timer.Stop()
+	}
+	delete(d.restarts, suid)
+	d.Unlock()
+}
+
+// cancelRestarts stops all scheduled restarts. It is called when cinitd is shutting down
+func (d *ProcessOperator) cancelRestarts() {
+	d.Lock()
+	for _, rs := range d.restarts {
+		if rs.timer != nil {
+			rs.timer.Stop()
+			rs.timer = nil
+		}
+		rs.nextRestart = nil
+	}
+	d.Unlock()
+}
+
+// gaveUp reports whether a service is no longer restarted because it reached its
+// restart limits
+func (d *ProcessOperator) gaveUp(suid string) bool {
+	d.Lock()
+	defer d.Unlock()
+	rs := d.restarts[suid]
+	return rs != nil && rs.gaveUp
+}
+
+// restartInfo returns the number of restarts, the next scheduled restart and the most
+// recent restart reasons of a service
+func (d *ProcessOperator) restartInfo(suid string) (int, *time.Time, []models.RestartRecord) {
+	d.Lock()
+	defer d.Unlock()
+	rs := d.restarts[suid]
+	if rs == nil {
+		return 0, nil, nil
+	}
+	records := make([]models.RestartRecord, len(rs.records))
+	copy(records, rs.records)
+	return rs.count, rs.nextRestart, records
+}
+
+// shouldRestart decides, based on the restart policy of the service, if a finished
+// handler needs to be started again
+func shouldRestart(policy string, handler *ProcessHandler) bool {
+	switch policy {
+	case restartAlways, restartUnlessStopped:
+		return true
+	case restartOnFailure:
+		return !handler.succeeded()
+	}
+	return false
+}
+
+// backoffDelay returns the delay for the next restart. The delay doubles for every
+// restart that happened within the restart window
+func backoffDelay(b *models.Backoff, restarts int) time.Duration {
+	delay, maxDelay := defaultRestartDelay, defaultRestartMaxDelay
+	if b != nil {
+		if b.Delay > 0 {
+			delay = b.Delay.D()
+		}
+		if b.MaxDelay > 0 {
+			maxDelay = b.MaxDelay.D()
+		}
+	}
+
+	for i := 0; i < restarts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// scheduleRestart is called once a ProcessHandler has finished. If the restart policy
+// of the service allows it, the service is pushed again to the service channel after
+// the backoff delay. It reports whether a restart has been scheduled
+func (d *ProcessOperator) scheduleRestart(handler *ProcessHandler) bool {
+	service := handler.service
+	if !shouldRestart(service.Restart, handler) {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if !d.allowPoolExpanding || d.processPool[service.SUID] != handler || handler.superseded {
+		return false
+	}
+
+	reason := fmt.Sprintf("restart policy %s, %s", service.Restart, handler.exitStatus)
+	if handler.err != nil {
+		reason = fmt.Sprintf("restart policy %s, %s", service.Restart, handler.err)
+	}
+	return d.restartLocked(service, reason)
+}
+
+// withinRestartLimits drops the restarts that are older than the restart window and
+// reports whether the service may be restarted once more. A service that reached its
+// limits is marked as given up and a gave-up event is published. The caller must hold
+// the lock
+func (d *ProcessOperator) withinRestartLimits(service models.Service, rs *restartState) bool {
+	window := defaultRestartWindow
+	maxRestarts := defaultMaxRestarts
+	if service.Backoff != nil {
+		if service.Backoff.Window > 0 {
+			window = service.Backoff.Window.D()
+		}
+		if service.Backoff.MaxRestarts != 0 {
+			maxRestarts = service.Backoff.MaxRestarts
+		}
+	}
+
+	now := time.Now()
+	history := rs.history[:0]
+	for _, t := range rs.history {
+		if now.Sub(t) < window {
+			history = append(history, t)
+		}
+	}
+	rs.history = history
+
+	if maxRestarts != unlimitedRestarts && len(rs.history) >= maxRestarts {
+		reason := fmt.Sprintf("restarted %d times within %s", len(rs.history), window)
+		d.logger.WithFields(logrus.Fields{
+			"Component": "ProcessPoolManager",
+			"Part":      "Supervisor",
+			"Name":      instanceName(service),
+		}).Errorf("Service %s. Giving up", reason)
+		if !rs.gaveUp && d.events != nil {
+			d.events.Publish(serviceEvent(service, events.Event{
+				Type:   events.GaveUp,
+				PUID:   service.SUID,
+				Reason: reason,
+			}))
+		}
+		rs.gaveUp = true
+		return false
+	}
+	return true
+}
+
+// restartLocked pushes the service again to the service channel after the backoff delay,
+// unless the service has been stopped, a restart is already scheduled or the restart
+// limits have been reached. The caller must hold the lock
+func (d *ProcessOperator) restartLocked(service models.Service, reason string) bool {
+	rs := d.restartStateFor(service.SUID)
+	if rs.stopped || rs.timer != nil || !d.withinRestartLimits(service, rs) {
+		return false
+	}
+
+	delay := backoffDelay(service.Backoff, len(rs.history))
+	next := time.Now().Add(delay)
+	rs.nextRestart = &next
+
+	d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Supervisor",
+		"Name":      instanceName(service),
+	}).Infof("Restarting service in %s (%s)", delay, reason)
+	if d.events != nil {
+		d.events.Publish(serviceEvent(service, events.Event{
+			Type:   events.Restarting,
+			PUID:   service.SUID,
+			Reason: fmt.Sprintf("in %s, %s", delay, reason),
+		}))
+	}
+	rs.timer = time.AfterFunc(delay, func() {
+		d.Lock()
+		if d.restarts[service.SUID] != rs || rs.timer == nil || !d.allowPoolExpanding {
+			d.Unlock()
+			return
+		}
+		now := time.Now()
+		rs.timer = nil
+		rs.nextRestart = nil
+		rs.count++
+		rs.history = append(rs.history, now)
+		rs.records = append(rs.records, models.RestartRecord{Time: now, Reason: reason})
+		if len(rs.records) > restartRecords {
+			rs.records = rs.records[len(rs.records)-restartRecords:]
+		}
+		d.Unlock()
+
+		newService := service
+		newService.T = "restart"
+		select {
+		case <-d.stopping:
+		case d.serviceChan.Data <- newService:
+		}
+	})
+	return true
+}
+
+// livenessRestart is called by the health monitor of a handler whose service failed
+// its health checks too many times in a row. The service is stopped and started again
+// after the backoff delay, within the restart limits of the service
+func (d *ProcessOperator) livenessRestart(handler *ProcessHandler, reason string) {
+	service := handler.service
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Supervisor",
+		"Name":      instanceName(service),
+	})
+
+	d.Lock()
+	if !d.allowPoolExpanding || d.processPool[service.SUID] != handler || handler.superseded {
+		d.Unlock()
+		return
+	}
+	rs := d.restartStateFor(service.SUID)
+	if rs.stopped || rs.timer != nil || !d.withinRestartLimits(service, rs) {
+		d.Unlock()
+		log.Warnf("Service is unhealthy but will not be restarted: %s", reason)
+		return
+	}
+	handler.superseded = true
+	d.Unlock()
+
+	log.Warnf("Stopping unhealthy service: %s", reason)
+	d.stopProcess(service.SUID)
+
+	d.Lock()
+	d.restartLocked(service, reason)
+	d.Unlock()
+}
@@ -0,0 +1,113 @@
+package processes
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func newTestOperator() *ProcessOperator {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return &ProcessOperator{
+		logger:   logger,
+		restarts: make(map[string]*restartState),
+		events:   events.NewBus(10),
+	}
+}
+
+// restartsWithin returns how many restarts withinRestartLimits allows for a service
+// restarted once per second, up to max
+func restartsWithin(d *ProcessOperator, service models.Service, max int) int {
+	d.Lock()
+	defer d.Unlock()
+	rs := d.restartStateFor(service.SUID)
+	start := time.Now().Add(-time.Duration(max) * time.Second)
+	for i := 0; i < max; i++ {
+		if !d.withinRestartLimits(service, rs) {
+			return i
+		}
+		rs.history = append(rs.history, start.Add(time.Duration(i)*time.Second))
+	}
+	return max
+}
+
+func TestRestartLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff *models.Backoff
+		want    int
+	}{
+		{name: "default", want: defaultMaxRestarts},
+		{name: "default with a backoff", backoff: &models.Backoff{Delay: models.Duration(time.Second)}, want: defaultMaxRestarts},
+		{name: "maxRestarts", backoff: &models.Backoff{MaxRestarts: 3}, want: 3},
+		{name: "unlimited", backoff: &models.Backoff{MaxRestarts: unlimitedRestarts}, want: 100},
+		// Restarts older than the window are forgotten
+		{name: "short window", backoff: &models.Backoff{MaxRestarts: 3, Window: models.Duration(2 * time.Second)}, want: 100},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		service := models.Service{Name: "web", SUID: "web", Backoff: tt.backoff}
+		if got := restartsWithin(d, service, 100); got != tt.want {
+			t.Errorf("%s: restarted %d times, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRestartLimitsGiveUp(t *testing.T) {
+	d := newTestOperator()
+	service := models.Service{Name: "web", SUID: "web", Backoff: &models.Backoff{MaxRestarts: 2}}
+	restartsWithin(d, service, 10)
+
+	if !d.gaveUp(service.SUID) {
+		t.Fatal("service is not marked as given up")
+	}
+	replay, sub := d.events.Subscribe(0, "", "")
+	sub.Close()
+	if len(replay) != 1 || replay[0].Type != events.GaveUp || replay[0].Name != "web" {
+		t.Fatalf("got events %+v, want one gave-up event", replay)
+	}
+	if replay[0].Reason != "restarted 2 times within 10m0s" {
+		t.Errorf("gave-up reason is %q", replay[0].Reason)
+	}
+
+	// Checking the limits again does not publish the event again
+	d.Lock()
+	d.withinRestartLimits(service, d.restartStateFor(service.SUID))
+	d.Unlock()
+	replay, sub = d.events.Subscribe(1, "", "")
+	sub.Close()
+	if len(replay) != 0 {
+		t.Errorf("got more events %+v", replay)
+	}
+
+	// Starting the service on request gives it a new window of restarts
+	d.markStopped(service.SUID, false)
+	if d.gaveUp(service.SUID) {
+		t.Error("service is still given up after it was started")
+	}
+	if got := restartsWithin(d, service, 10); got != 2 {
+		t.Errorf("restarted %d times after it was started, want 2", got)
+	}
+}
+
+func TestGaveUpStatus(t *testing.T) {
+	d := newTestOperator()
+	now := time.Now()
+	d.processPool = map[string]*ProcessHandler{
+		"web": {service: models.Service{Name: "web", SUID: "web"}, exitTime: &now},
+	}
+	sa := models.ServiceAction{T: "status", Name: "web", SUID: "web"}
+
+	if got := d.serviceAction(sa, nil, nil).Status; got != "stopped" {
+		t.Errorf("status is %s, want stopped", got)
+	}
+	d.restartStateFor("web").gaveUp = true
+	if got := d.serviceAction(sa, nil, nil).Status; got != "failed" {
+		t.Errorf("status is %s after giving up, want failed", got)
+	}
+}
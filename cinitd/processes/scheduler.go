@@ -0,0 +1,367 @@
+package processes
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	overlapSkip    = "skip"
+	overlapQueue   = "queue"
+	overlapReplace = "replace"
+
+	// defaultRunHistory is the number of finished runs kept per scheduled service
+	defaultRunHistory = 10
+)
+
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// scheduleState keeps track of the timer and the runs of a scheduled service
+type scheduleState struct {
+	service models.Service
+	spec    cron.Schedule
+	cancel  context.CancelFunc
+	nextRun *time.Time
+	paused  bool
+	queued  bool
+	active  int
+	runs    []models.RunRecord
+}
+
+// OverlapPolicies lists the supported values of a service overlap policy. The policy
+// decides what happens when a scheduled run is due while the previous run is still running
+func OverlapPolicies() []string {
+	return []string{overlapSkip, overlapQueue, overlapReplace}
+}
+
+// ParseSchedule checks a schedule. Schedules are cron expressions with five fields,
+// descriptors like @hourly or intervals like @every 5m
+func ParseSchedule(spec string) error {
+	_, err := cron.ParseStandard(spec)
+	return err
+}
+
+func isScheduled(service models.Service) bool {
+	return service.Schedule != ""
+}
+
+func (d *ProcessOperator) isScheduledSUID(suid string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.schedules[suid] != nil
+}
+
+// addSchedule starts the timer of a newly registered scheduled service. Registering a
+// service that is already scheduled resumes its timer and runs it immediately
+func (d *ProcessOperator) addSchedule(service models.Service) {
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Scheduler",
+		"Name":      service.Name,
+	})
+
+	spec, err := cron.ParseStandard(service.Schedule)
+	if err != nil {
+		log.Errorf("Invalid schedule %s: %s", service.Schedule, err)
+		return
+	}
+
+	d.Lock()
+	if !d.allowPoolExpanding {
+		d.Unlock()
+		return
+	}
+	if d.schedules[service.SUID] != nil {
+		d.Unlock()
+		d.resumeSchedule(service.SUID)
+		d.fireSchedule(service.SUID)
+		return
+	}
+	ss := &scheduleState{
+		service: service,
+		spec:    spec,
+	}
+	d.schedules[service.SUID] = ss
+	d.startTimerLocked(ss)
+	d.Unlock()
+
+	log.Infof("Service scheduled with %s", service.Schedule)
+}
+
+// startTimerLocked starts the timer goroutine of a schedule. The caller must hold the lock
+func (d *ProcessOperator) startTimerLocked(ss *scheduleState) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ss.cancel = cancel
+	ss.paused = false
+	go d.runTimer(ctx, ss)
+}
+
+// runTimer pushes the service of a schedule to the timer channel every time the schedule
+// fires, delayed by a random jitter, until ctx is canceled or cinitd is shutting down
+func (d *ProcessOperator) runTimer(ctx context.Context, ss *scheduleState) {
+	for {
+		d.Lock()
+		next := ss.spec.Next(time.Now())
+		if jitter := ss.service.Jitter.D(); jitter > 0 {
+			next = next.Add(time.Duration(jitterRand.Int63n(int64(jitter))))
+		}
+		ss.nextRun = &next
+		d.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.stopping:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopping:
+			return
+		case d.timers.Data <- ss.service:
+		}
+	}
+}
+
+// pauseSchedule stops the timer of a schedule until it is resumed
+func (d *ProcessOperator) pauseSchedule(suid string) {
+	d.Lock()
+	if ss := d.schedules[suid]; ss != nil && !ss.paused {
+		ss.cancel()
+		ss.paused = true
+		ss.queued = false
+		ss.nextRun = nil
+	}
+	d.Unlock()
+}
+
+// resumeSchedule starts the timer of a paused schedule again
+func (d *ProcessOperator) resumeSchedule(suid string) {
+	d.Lock()
+	if ss := d.schedules[suid]; ss != nil && ss.paused && d.allowPoolExpanding {
+		d.startTimerLocked(ss)
+	}
+	d.Unlock()
+}
+
+// removeSchedule stops the timer of a deleted service and forgets its runs
+func (d *ProcessOperator) removeSchedule(suid string) {
+	d.Lock()
+	if ss := d.schedules[suid]; ss != nil {
+		ss.cancel()
+	}
+	delete(d.schedules, suid)
+	d.Unlock()
+}
+
+// fireSchedule starts a run of a scheduled service. If the previous run is still running
+// the overlap policy of the service decides if the run is skipped, queued until the
+// previous run finishes, or replaces the previous run
+func (d *ProcessOperator) fireSchedule(suid string) {
+	d.Lock()
+	ss := d.schedules[suid]
+	if ss == nil || !d.allowPoolExpanding {
+		d.Unlock()
+		return
+	}
+	service := ss.service
+	active := ss.active
+	if active > 0 && service.Overlap == overlapQueue {
+		ss.queued = true
+	}
+	d.Unlock()
+
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Scheduler",
+		"Name":      service.Name,
+	})
+
+	if active > 0 {
+		switch service.Overlap {
+		case overlapQueue:
+			log.Info("Previous run is still running. Next run has been queued")
+			return
+		case overlapReplace:
+			log.Info("Previous run is still running. Replacing it")
+			d.stopProcess(suid)
+		default:
+			log.Info("Previous run is still running. Skipping run")
+			return
+		}
+	}
+
+	d.startRun(suid)
+}
+
+// startRun pushes a scheduled service to the service channel
+func (d *ProcessOperator) startRun(suid string) {
+	d.Lock()
+	ss := d.schedules[suid]
+	if ss == nil || !d.allowPoolExpanding {
+		d.Unlock()
+		return
+	}
+	ss.active++
+	newService := ss.service
+	newService.T = "run"
+	d.Unlock()
+
+	d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Scheduler",
+		"Name":      newService.Name,
+	}).Info("Starting scheduled run")
+
+	select {
+	case <-d.stopping:
+	case d.serviceChan.Data <- newService:
+	}
+}
+
+// scheduledRunFinished records a finished run of a scheduled service and starts the
+// queued run, if any
+func (d *ProcessOperator) scheduledRunFinished(handler *ProcessHandler) {
+	service := handler.service
+	if !isScheduled(service) {
+		return
+	}
+
+	d.Lock()
+	ss := d.schedules[service.SUID]
+	if ss == nil {
+		d.Unlock()
+		return
+	}
+	if ss.active > 0 {
+		ss.active--
+	}
+
+	record := models.RunRecord{
+		ExitStatus: handler.exitStatus,
+		ExitCode:   handler.exitCode,
+	}
+	if handler.startTime != nil {
+		record.Start = *handler.startTime
+	}
+	if handler.exitTime != nil {
+		record.End = *handler.exitTime
+	}
+	if handler.err != nil {
+		record.ExitStatus = handler.err.Error()
+	}
+
+	limit := service.RunHistory
+	if limit <= 0 {
+		limit = defaultRunHistory
+	}
+	ss.runs = append(ss.runs, record)
+	if len(ss.runs) > limit {
+		ss.runs = ss.runs[len(ss.runs)-limit:]
+	}
+
+	queued := ss.queued && ss.active == 0 && !ss.paused && d.allowPoolExpanding
+	if queued {
+		ss.queued = false
+	}
+	d.Unlock()
+
+	if queued {
+		d.startRun(service.SUID)
+	}
+}
+
+// scheduleAction handles a service action for a scheduled service. Stopping a scheduled
+// service stops its current run and pauses its timer, starting it resumes the timer and
+// runs the service immediately. Restarting it stops the current run before starting it
+func (d *ProcessOperator) scheduleAction(sa *models.ServiceAction) {
+	switch sa.T {
+	case "stop":
+		d.pauseSchedule(sa.SUID)
+		d.stopProcess(sa.SUID)
+	case "delete":
+		d.removeSchedule(sa.SUID)
+		d.stopProcess(sa.SUID)
+		d.removeCgroup(sa.Name)
+		d.logs.Remove(sa.Name)
+		d.Lock()
+		delete(d.processPool, sa.SUID)
+		d.Unlock()
+
+		sa.Status = "deleted"
+		return
+	case "start":
+		d.resumeSchedule(sa.SUID)
+		d.fireSchedule(sa.SUID)
+	case "restart":
+		d.stopProcess(sa.SUID)
+		d.resumeSchedule(sa.SUID)
+		d.fireSchedule(sa.SUID)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	ss := d.schedules[sa.SUID]
+	if ss == nil {
+		sa.Status = "stopped"
+		return
+	}
+
+	handler := d.processPool[sa.SUID]
+	switch {
+	case handler != nil && handler.startTime != nil && handler.exitTime == nil:
+		sa.Status = "running"
+		sa.PID = fmt.Sprintf("%d", handler.process.Pid)
+		sa.Usage, _ = d.cgroups.Usage(sa.Name)
+	case ss.active > 0:
+		sa.Status = "starting"
+	case ss.paused:
+		sa.Status = "stopped"
+	default:
+		sa.Status = "scheduled"
+	}
+
+	if handler != nil {
+		sa.StartTime = handler.startTime
+		sa.ExitTime = handler.exitTime
+		sa.ExitStatus = handler.exitStatus
+		sa.Error = handler.err
+		sa.StopResult = handler.stopResult
+		sa.Argv = handler.argv
+	}
+	sa.NextRun = ss.nextRun
+	sa.Runs = make([]models.RunRecord, len(ss.runs))
+	copy(sa.Runs, ss.runs)
+}
+
+// timerOperator starts the runs of the scheduled services whose timer has fired
+func (d *ProcessOperator) timerOperator(ctx context.Context, wg *sync.WaitGroup) {
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "TimerOperator",
+	})
+	for {
+		select {
+		case service := <-d.timers.Data:
+			go d.fireSchedule(service.SUID)
+		case <-ctx.Done():
+			wg.Done()
+			log.Infof("Bye!")
+			return
+		}
+	}
+}
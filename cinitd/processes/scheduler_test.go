@@ -0,0 +1,267 @@
+package processes
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func newTestScheduler(t *testing.T, service models.Service) (*ProcessOperator, *scheduleState) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	d := NewProcessOperator(nil, logger, false, channels.NewServiceChannel(1, 1), nil, nil, nil)
+	t.Cleanup(func() { close(d.stopping) })
+
+	spec, err := cron.ParseStandard(service.Schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := &scheduleState{service: service, spec: spec, cancel: func() {}}
+	d.schedules[service.SUID] = ss
+	return d, ss
+}
+
+// expectRun waits for a run of a scheduled service to be pushed to the service channel
+func expectRun(t *testing.T, d *ProcessOperator, want bool) {
+	t.Helper()
+	select {
+	case s := <-d.serviceChan.Data:
+		if !want {
+			t.Fatalf("run of %s started", s.Name)
+		}
+		if s.T != "run" {
+			t.Errorf("run pushed with type %q", s.T)
+		}
+	case <-time.After(200 * time.Millisecond):
+		if want {
+			t.Fatal("run did not start")
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"*/5 * * * *", "@hourly", "@every 90s", "@every 1h30m"} {
+		if err := ParseSchedule(spec); err != nil {
+			t.Errorf("%s: %s", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "@every", "@every 5x", "@sometimes"} {
+		if err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+
+	spec, err := cron.ParseStandard("@every 5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 10, 17, 15, 4, 10, 0, time.UTC)
+	if next := spec.Next(now); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("@every 5m fires at %s after %s", next, now)
+	}
+}
+
+func TestRunTimerEvery(t *testing.T) {
+	d, ss := newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@every 1s"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.runTimer(ctx, ss)
+
+	// Intervals are counted in whole seconds, the first one may be shorter
+	var fired []time.Time
+	for i := 1; i <= 2; i++ {
+		select {
+		case s := <-d.timers.Data:
+			if s.SUID != "job" {
+				t.Errorf("timer fired for %s", s.SUID)
+			}
+			fired = append(fired, time.Now())
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timer did not fire %d times", i)
+		}
+	}
+	if gap := fired[1].Sub(fired[0]); gap < 900*time.Millisecond || gap > 1500*time.Millisecond {
+		t.Errorf("timer fired again after %s, want 1s", gap)
+	}
+
+	d.Lock()
+	next := ss.nextRun
+	d.Unlock()
+	if next == nil || time.Until(*next) > time.Second {
+		t.Errorf("next run is %v", next)
+	}
+
+	// A canceled timer stops firing
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-d.timers.Data:
+		t.Error("canceled timer fired")
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestRunTimerJitter(t *testing.T) {
+	d, ss := newTestScheduler(t, models.Service{
+		Name:     "job",
+		SUID:     "job",
+		Schedule: "@every 1h",
+		Jitter:   models.Duration(time.Minute),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		timerCtx, stop := context.WithCancel(ctx)
+		go d.runTimer(timerCtx, ss)
+
+		var next *time.Time
+		for deadline := time.Now().Add(time.Second); next == nil && time.Now().Before(deadline); {
+			d.Lock()
+			next = ss.nextRun
+			ss.nextRun = nil
+			d.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		if next == nil {
+			t.Fatal("timer did not set the next run")
+		}
+		delay := next.Sub(start.Truncate(time.Second))
+		if delay < time.Hour || delay > time.Hour+time.Minute+time.Second {
+			t.Errorf("next run in %s, want within the jitter after 1h", delay)
+		}
+	}
+}
+
+func TestOverlapSkip(t *testing.T) {
+	for _, overlap := range []string{"", overlapSkip} {
+		d, ss := newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@hourly", Overlap: overlap})
+
+		go d.fireSchedule("job")
+		expectRun(t, d, true)
+
+		// The first run is still active
+		go d.fireSchedule("job")
+		expectRun(t, d, false)
+
+		d.Lock()
+		if ss.active != 1 || ss.queued {
+			t.Errorf("overlap %q: %d active runs, queued %v", overlap, ss.active, ss.queued)
+		}
+		d.Unlock()
+
+		d.scheduledRunFinished(&ProcessHandler{service: ss.service})
+		expectRun(t, d, false)
+	}
+}
+
+func TestOverlapQueue(t *testing.T) {
+	d, ss := newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@hourly", Overlap: overlapQueue})
+
+	go d.fireSchedule("job")
+	expectRun(t, d, true)
+
+	// Runs due while the first one is active are queued once
+	d.fireSchedule("job")
+	d.fireSchedule("job")
+	expectRun(t, d, false)
+
+	d.Lock()
+	if !ss.queued {
+		t.Error("run was not queued")
+	}
+	d.Unlock()
+
+	go d.scheduledRunFinished(&ProcessHandler{service: ss.service})
+	expectRun(t, d, true)
+
+	d.Lock()
+	if ss.active != 1 || ss.queued {
+		t.Errorf("%d active runs, queued %v after the queued run started", ss.active, ss.queued)
+	}
+	d.Unlock()
+
+	d.scheduledRunFinished(&ProcessHandler{service: ss.service})
+	expectRun(t, d, false)
+
+	// A paused schedule drops its queued run
+	go d.fireSchedule("job")
+	expectRun(t, d, true)
+	d.fireSchedule("job")
+	d.pauseSchedule("job")
+	d.scheduledRunFinished(&ProcessHandler{service: ss.service})
+	expectRun(t, d, false)
+}
+
+func TestOverlapReplace(t *testing.T) {
+	d, ss := newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@hourly", Overlap: overlapReplace})
+
+	go d.fireSchedule("job")
+	expectRun(t, d, true)
+
+	// The active run is stopped and a new one started right away
+	go d.fireSchedule("job")
+	expectRun(t, d, true)
+
+	d.Lock()
+	if ss.active != 2 || ss.queued {
+		t.Errorf("%d active runs, queued %v", ss.active, ss.queued)
+	}
+	d.Unlock()
+}
+
+func TestRunHistory(t *testing.T) {
+	d, ss := newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@hourly", RunHistory: 3})
+
+	start := time.Date(2021, 10, 17, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		started, exited := start.Add(time.Duration(i)*time.Hour), start.Add(time.Duration(i)*time.Hour+time.Second)
+		d.scheduledRunFinished(&ProcessHandler{
+			service:    ss.service,
+			startTime:  &started,
+			exitTime:   &exited,
+			exitStatus: "exit status 1",
+			exitCode:   i,
+		})
+	}
+	d.scheduledRunFinished(&ProcessHandler{service: ss.service, err: errors.New("exec: not found")})
+
+	d.Lock()
+	runs := append([]models.RunRecord(nil), ss.runs...)
+	d.Unlock()
+	if len(runs) != 3 {
+		t.Fatalf("kept %d runs, want 3", len(runs))
+	}
+	if runs[0].ExitCode != 3 || !runs[0].Start.Equal(start.Add(3*time.Hour)) || runs[0].End.Sub(runs[0].Start) != time.Second {
+		t.Errorf("oldest kept run is %+v", runs[0])
+	}
+	if runs[2].ExitStatus != "exec: not found" || !runs[2].Start.IsZero() {
+		t.Errorf("run that could not start is %+v", runs[2])
+	}
+
+	// Without runHistory the default number of runs is kept
+	d, ss = newTestScheduler(t, models.Service{Name: "job", SUID: "job", Schedule: "@hourly"})
+	for i := 0; i < defaultRunHistory+5; i++ {
+		d.scheduledRunFinished(&ProcessHandler{service: ss.service})
+	}
+	if len(ss.runs) != defaultRunHistory {
+		t.Errorf("kept %d runs, want %d", len(ss.runs), defaultRunHistory)
+	}
+
+	// Runs of services that are not scheduled are not recorded
+	d.scheduledRunFinished(&ProcessHandler{service: models.Service{Name: "web", SUID: "job"}})
+	if len(ss.runs) != defaultRunHistory {
+		t.Errorf("run of a service without a schedule was recorded")
+	}
+}
@@ -0,0 +1,122 @@
+package processes
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/utils"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultStopTimeout = 10 * time.Second
+
+	// killTimeout is how long a process is waited for after SIGKILL
+	killTimeout = 10 * time.Second
+
+	stopGraceful = "graceful"
+	stopKilled   = "killed"
+)
+
+// stopSettings returns the stop signal and the stop timeout of a service
+func stopSettings(service models.Service) (syscall.Signal, time.Duration) {
+	sig, timeout := syscall.SIGTERM, defaultStopTimeout
+	if service.StopSignal != "" {
+		if s, err := utils.ParseSignal(service.StopSignal); err == nil {
+			sig = s
+		}
+	}
+	if service.StopTimeout > 0 {
+		timeout = service.StopTimeout.D()
+	}
+	return sig, timeout
+}
+
+// signal sends a signal to the process of the handler, or to its process group if the
+// service has signalProcessGroup set
+func (w *ProcessHandler) signal(sig syscall.Signal) error {
+	return w.kill(sig, w.service.SignalProcessGroup)
+}
+
+// kill sends a signal to the process of the handler or to its process group. Services
+// run in their own session, so the process group id is the pid of the service
+func (w *ProcessHandler) kill(sig syscall.Signal, group bool) error {
+	if w.process == nil || w.process.Pid <= 0 {
+		return syscall.ESRCH
+	}
+	if group {
+		return syscall.Kill(-w.process.Pid, sig)
+	}
+	return syscall.Kill(w.process.Pid, sig)
+}
+
+// waitExit waits for the process of the handler to exit. It reports false on timeout
+func (w *ProcessHandler) waitExit(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		w.lock.Lock()
+		exited := w.exitTime != nil
+		w.lock.Unlock()
+		if exited {
+			return true
+		}
+
+		select {
+		case <-deadline:
+			return false
+		case <-time.After(25 * time.Millisecond):
+		}
+	}
+}
+
+// stopProcess stops the process of a service
+func (d *ProcessOperator) stopProcess(suid string) {
+	d.Lock()
+	handler := d.processPool[suid]
+	d.Unlock()
+
+	if handler != nil {
+		d.stopHandler(handler)
+	}
+}
+
+// stopHandler sends the stop signal of the service to the process of the handler and
+// waits for it to exit. Processes that are still running after the stop timeout are
+// killed. Whether the process stopped gracefully is recorded in the handler
+func (d *ProcessOperator) stopHandler(handler *ProcessHandler) {
+	d.Lock()
+	running := handler.startTime != nil && handler.exitTime == nil
+	service := handler.service
+	d.Unlock()
+	if !running {
+		return
+	}
+
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ProcessPoolManager",
+		"Part":      "Stop",
+		"Name":      instanceName(service),
+	})
+
+	sig, timeout := stopSettings(service)
+	log.Infof("Sending %s, waiting up to %s", unix.SignalName(sig), timeout)
+	if err := handler.signal(sig); err != nil && err != syscall.ESRCH {
+		log.Warnf("Could not send %s: %s", unix.SignalName(sig), err)
+	}
+
+	result := stopGraceful
+	if !handler.waitExit(timeout) {
+		result = stopKilled
+		log.Warnf("Service did not stop within %s. Sending SIGKILL", timeout)
+		handler.signal(syscall.SIGKILL)
+		if !handler.waitExit(killTimeout) {
+			log.Errorf("Service did not exit %s after SIGKILL", killTimeout)
+		}
+	}
+
+	d.Lock()
+	handler.stopResult = result
+	d.Unlock()
+}
@@ -0,0 +1,158 @@
+package processes
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// startTestHandler runs script in a session of its own as the process of a handler of d.
+// The script must print ready once it has set up its traps. The stdout of the script
+// after that is returned
+func startTestHandler(t *testing.T, d *ProcessOperator, service models.Service, script string) (*ProcessHandler, *bufio.Reader) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prc, err := os.StartProcess("/bin/sh", []string{"sh", "-c", script}, &os.ProcAttr{
+		Files: []*os.File{nil, w, nil},
+		Sys:   &syscall.SysProcAttr{Setsid: true},
+	})
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		syscall.Kill(-prc.Pid, syscall.SIGKILL)
+		r.Close()
+	})
+
+	now := time.Now()
+	handler := &ProcessHandler{
+		service:   service,
+		process:   prc,
+		startTime: &now,
+		reaper:    d.reaper,
+		lock:      d,
+	}
+	go func() {
+		state, err := prc.Wait()
+		d.Lock()
+		defer d.Unlock()
+		exited := time.Now()
+		handler.exitTime = &exited
+		if err == nil {
+			handler.exitStatus, handler.exitCode = state.String(), state.ExitCode()
+		}
+	}()
+
+	out := bufio.NewReader(r)
+	if line, err := out.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("script printed %q, %v", line, err)
+	}
+	return handler, out
+}
+
+func TestStopSettings(t *testing.T) {
+	tests := []struct {
+		service models.Service
+		sig     syscall.Signal
+		timeout time.Duration
+	}{
+		{sig: syscall.SIGTERM, timeout: defaultStopTimeout},
+		{service: models.Service{StopSignal: "SIGINT"}, sig: syscall.SIGINT, timeout: defaultStopTimeout},
+		{service: models.Service{StopSignal: "quit", StopTimeout: models.Duration(time.Minute)}, sig: syscall.SIGQUIT, timeout: time.Minute},
+		// Invalid signals are rejected on register, the default is kept
+		{service: models.Service{StopSignal: "SIGFOO"}, sig: syscall.SIGTERM, timeout: defaultStopTimeout},
+	}
+	for _, tt := range tests {
+		sig, timeout := stopSettings(tt.service)
+		if sig != tt.sig || timeout != tt.timeout {
+			t.Errorf("%+v: got %s, %s, want %s, %s", tt.service, sig, timeout, tt.sig, tt.timeout)
+		}
+	}
+}
+
+func TestStopHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		service models.Service
+		script  string
+		result  string
+		status  string
+	}{
+		{
+			name:   "exits on the stop signal",
+			script: "echo ready; exec sleep 5",
+			result: stopGraceful,
+			status: "signal: terminated",
+		},
+		{
+			name:    "exits on the stop signal of the service",
+			service: models.Service{StopSignal: "SIGINT"},
+			script:  `trap "exit 0" INT; trap "" TERM; echo ready; while :; do sleep 0.05; done`,
+			result:  stopGraceful,
+			status:  "exit status 0",
+		},
+		{
+			name:    "ignores the stop signal",
+			service: models.Service{StopTimeout: models.Duration(200 * time.Millisecond)},
+			script:  `trap "" TERM; echo ready; exec sleep 5`,
+			result:  stopKilled,
+			status:  "signal: killed",
+		},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		d.reaper = newReaper()
+		handler, _ := startTestHandler(t, d, tt.service, tt.script)
+
+		start := time.Now()
+		d.stopHandler(handler)
+		if elapsed := time.Since(start); tt.result == stopKilled && elapsed < 200*time.Millisecond {
+			t.Errorf("%s: killed after %s, before the stop timeout", tt.name, elapsed)
+		}
+
+		d.Lock()
+		result, status := handler.stopResult, handler.exitStatus
+		d.Unlock()
+		if result != tt.result || status != tt.status {
+			t.Errorf("%s: got %s, %q, want %s, %q", tt.name, result, status, tt.result, tt.status)
+		}
+	}
+}
+
+func TestStopHandlerNotRunning(t *testing.T) {
+	d := newTestOperator()
+	now := time.Now()
+	for _, handler := range []*ProcessHandler{
+		{lock: d},
+		{lock: d, startTime: &now, exitTime: &now},
+	} {
+		d.stopHandler(handler)
+		if handler.stopResult != "" {
+			t.Errorf("stop result %q for a process that is not running", handler.stopResult)
+		}
+	}
+}
+
+func TestStopResultStatus(t *testing.T) {
+	d := newTestOperator()
+	d.reaper = newReaper()
+	handler, _ := startTestHandler(t, d, models.Service{Name: "web", SUID: "web"}, "echo ready; exec sleep 5")
+	d.processPool = map[string]*ProcessHandler{"web": handler}
+
+	sa := d.serviceAction(models.ServiceAction{T: "stop", Name: "web", SUID: "web"}, nil, nil)
+	if sa.Status != "stopped" || sa.StopResult != stopGraceful {
+		t.Errorf("got status %s, stop result %q after stop", sa.Status, sa.StopResult)
+	}
+	if !strings.Contains(sa.ExitStatus, "terminated") {
+		t.Errorf("exit status is %q", sa.ExitStatus)
+	}
+}
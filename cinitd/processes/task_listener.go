@@ -3,12 +3,13 @@ package processes
 import (
 	"context"
 	"os"
-	"os/exec"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
 )
 
 func (d *ProcessOperator) taskListener(ctx context.Context, serviceQueue chan *Task, serviceChan *channels.Service, wg *sync.WaitGroup) {
@@ -29,44 +30,21 @@ func (d *ProcessOperator) taskListener(ctx context.Context, serviceQueue chan *T
 				break
 			}
 
-			args := []string{service.Command}
-			if len(service.Args) > 0 {
-				args = append(args, service.Args...)
+			if isScheduled(service) && service.T == "register" {
+				d.addSchedule(service)
+				break
 			}
-			task := Task{
-				suid: service.SUID,
-				Name: service.Name,
-				processInfo: map[string][]string{
-					"args": args,
-				},
-				Exec: func() (*os.Process, error) {
-					fork := newProcessFactory(
-						service.SUID,
-						d.serviceLogDir,
-						"/",
-						service.Name,
-						uint32(os.Getuid()),
-						uint32(os.Getgid()),
-					)
-
-					path, err := exec.LookPath(service.Command)
-					if err != nil {
-						return &os.Process{
-							Pid: -1,
-						}, err
-					}
-
-					prc, err := fork.exec(path, args)
-					if err != nil {
-						return &os.Process{
-							Pid: -1,
-						}, err
-					}
-					return prc, nil
-				},
+
+			if service.Replicas > 0 && service.ReplicaOf == "" {
+				instances := d.addReplicaSet(service)
+				for _, instance := range instances {
+					serviceQueue <- d.newTask(instance)
+				}
+				log.Infof("Registered %d replica tasks", len(instances))
+				break
 			}
 
-			serviceQueue <- &task
+			serviceQueue <- d.newTask(service)
 			log.Infof("Registered new task")
 		case <-ctx.Done():
 			wg.Done()
@@ -77,3 +55,83 @@ func (d *ProcessOperator) taskListener(ctx context.Context, serviceQueue chan *T
 		}
 	}
 }
+
+// newTask creates the task that starts the process of a service
+func (d *ProcessOperator) newTask(service models.Service) *Task {
+	task := &Task{
+		suid:    service.SUID,
+		Name:    instanceName(service),
+		service: service,
+	}
+	task.Exec = func() (*os.Process, error) {
+		env, err := serviceEnv(service)
+		if err != nil {
+			return &os.Process{
+				Pid: -1,
+			}, err
+		}
+
+		argv := serviceArgv(service, env)
+		task.argv = argv
+
+		path, err := lookPath(argv[0], env)
+		if err != nil {
+			return &os.Process{
+				Pid: -1,
+			}, err
+		}
+
+		// The cgroup and its limits are in place before the process starts
+		cgroup, err := d.cgroups.Prepare(instanceName(service), service.Resources)
+		if err != nil {
+			return &os.Process{
+				Pid: -1,
+			}, wrapErr(err)
+		}
+		if cgroup != nil {
+			defer cgroup.Close()
+		}
+
+		stdout, err := d.logs.Output(instanceName(service), logs.Stdout, service.LogTarget, service.LogRotation)
+		if err != nil {
+			return &os.Process{
+				Pid: -1,
+			}, wrapErr(err)
+		}
+		stderr, err := d.logs.Output(instanceName(service), logs.Stderr, service.LogTarget, service.LogRotation)
+		if err != nil {
+			stdout.Close()
+			return &os.Process{
+				Pid: -1,
+			}, wrapErr(err)
+		}
+
+		// From here on the outputs are closed by fork.exec
+		uid, gid, groups := serviceCredential(service)
+		fork := newProcessFactory(
+			service.SUID,
+			serviceDir(service),
+			uid,
+			gid,
+			groups,
+			env,
+			cgroup,
+			stdout,
+			stderr,
+		)
+
+		if needsLimits(service) {
+			fork.limits = newExecSpec(service, path, argv)
+		}
+
+		prc, err := fork.exec(path, argv)
+		if err != nil {
+			return &os.Process{
+				Pid: -1,
+			}, err
+		}
+		return prc, nil
+	}
+
+	return task
+}
@@ -1,42 +1,18 @@
 package processes
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/logs"
 	"github.com/ulfox/cinit/cinitd/models"
 )
 
-func (d *ProcessOperator) stopProcess(suid string) {
-	if d.processPool[suid] == nil {
-		return
-	}
-
-	d.processPool[suid].process.Kill()
-	var terminated bool
-	for {
-		select {
-		case <-time.After(10 * time.Second):
-			d.processPool[suid].process.Signal(syscall.SIGKILL)
-			return
-		default:
-			if d.processPool[suid].exitTime != nil {
-				terminated = true
-			} else {
-				terminated = false
-			}
-			if terminated {
-				return
-			}
-		}
-	}
-}
-
 func (d *ProcessOperator) taskOperator(ctx context.Context, serviceQueue chan *Task, serviceChan *channels.Service, wg *sync.WaitGroup) {
 	log := d.logger.WithFields(logrus.Fields{
 		"Component": "ProcessPoolManager",
@@ -61,6 +37,7 @@ func (d *ProcessOperator) taskOperator(ctx context.Context, serviceQueue chan *T
 					case sa = <-s:
 						break rLoop
 					case <-time.After(10 * time.Second):
+						serviceChan.Timeout()
 						l.Error("Done waiting for client")
 						return
 					}
@@ -70,103 +47,16 @@ func (d *ProcessOperator) taskOperator(ctx context.Context, serviceQueue chan *T
 					l.Error("Service SUID can not be empty")
 				}
 
-				if d.processPool[sa.SUID] == nil {
-					sa.Status = "stopped"
-					s <- sa
-					return
-				}
-
-				if sa.T == "stop" || sa.T == "delete" {
-					d.stopProcess(sa.SUID)
-				}
-
-				if sa.T == "delete" {
-					d.Lock()
-					delete(d.processPool, sa.SUID)
-					d.Unlock()
-
-					sa.Status = "deleted"
-					s <- sa
-					return
-				}
-
-				if d.processPool[sa.SUID].exitTime == nil {
-					sa.Status = "running"
-					sa.PID = fmt.Sprintf("%d", d.processPool[sa.SUID].process.Pid)
+				if set := d.replicaSet(sa.SUID); set != nil {
+					sa = d.replicaAction(sa, set, serviceChan, l)
 				} else {
-					sa.Status = "stopped"
+					sa = d.serviceAction(sa, serviceChan, l)
 				}
 
-				if sa.T == "start" {
-					if sa.Status == "running" {
-						l.Error("Can not start service. Already running...")
-					} else {
-						newService := models.Service{
-							T:       sa.T,
-							Name:    sa.Name,
-							SUID:    sa.SUID,
-							Command: d.processPool[sa.SUID].processInfo["args"][0],
-							Args:    d.processPool[sa.SUID].processInfo["args"][1:],
-						}
-						d.Lock()
-						delete(d.processPool, sa.SUID)
-						d.Unlock()
-
-						serviceChan.Push(newService)
-
-						l.Info("Starting service...")
-
-						var poolAdd bool
-					poolAddLoop:
-						for {
-							select {
-							case <-time.After(5 * time.Second):
-								break poolAddLoop
-							default:
-								if d.processPool[sa.SUID] != nil {
-									poolAdd = true
-								} else {
-									poolAdd = false
-								}
-								if poolAdd {
-									break poolAddLoop
-								}
-							}
-						}
-
-						if !poolAdd {
-							l.Error("Done waiting for service to be added in the pool")
-							s <- sa
-							return
-						}
-
-						var started bool
-					poolStartLoop:
-						for {
-							select {
-							case <-time.After(5 * time.Second):
-								break poolStartLoop
-							default:
-								if d.processPool[sa.SUID].startTime != nil {
-									started = true
-								} else {
-									started = false
-								}
-								if started {
-									sa.Status = "running"
-									sa.PID = fmt.Sprintf("%d", d.processPool[sa.SUID].process.Pid)
-									break poolStartLoop
-								}
-							}
-						}
-					}
+				if sa.T == "logs" {
+					d.logsAction(&sa)
 				}
 
-				sa.ExitTime = d.processPool[sa.SUID].exitTime
-				sa.StartTime = d.processPool[sa.SUID].startTime
-				sa.ExitStatus = d.processPool[sa.SUID].exitStatus
-				sa.Error = d.processPool[sa.SUID].err
-
 				s <- sa
 				l.Infof("Service Action %s finished", sa.Name)
 			}(service, &serviceInfoWG, log)
@@ -180,3 +70,266 @@ func (d *ProcessOperator) taskOperator(ctx context.Context, serviceQueue chan *T
 		}
 	}
 }
+
+// serviceAction runs an action on the process of a service and returns its outcome
+func (d *ProcessOperator) serviceAction(sa models.ServiceAction, serviceChan *channels.Service, l *logrus.Entry) models.ServiceAction {
+	if sa.T == "reload" || sa.T == "signal" {
+		d.signalAction(&sa)
+	}
+
+	if d.isScheduledSUID(sa.SUID) {
+		d.scheduleAction(&sa)
+		return sa
+	}
+
+	d.Lock()
+	handler := d.processPool[sa.SUID]
+	d.Unlock()
+	if handler == nil {
+		sa.Status = "stopped"
+		return sa
+	}
+
+	if sa.T == "stop" || sa.T == "delete" {
+		d.markStopped(sa.SUID, true)
+		d.stopProcess(sa.SUID)
+	}
+
+	if sa.T == "delete" {
+		d.forgetRestarts(sa.SUID)
+		d.removeCgroup(sa.Name)
+		d.logs.Remove(sa.Name)
+		d.Lock()
+		delete(d.processPool, sa.SUID)
+		d.Unlock()
+
+		sa.Status = "deleted"
+		return sa
+	}
+
+	sa.Status, sa.PID = d.handlerStatus(handler)
+
+	var stopResult string
+	if sa.T == "restart" && sa.Status == "running" {
+		d.Lock()
+		handler.superseded = true
+		d.Unlock()
+
+		l.Info("Stopping service for restart...")
+		d.stopHandler(handler)
+		d.Lock()
+		stopResult = handler.stopResult
+		d.Unlock()
+		sa.Status = "stopped"
+	}
+
+	if sa.T == "start" || sa.T == "restart" {
+		if sa.Status == "running" {
+			l.Error("Can not start service. Already running...")
+		} else {
+			d.markStopped(sa.SUID, false)
+			d.Lock()
+			newService := handler.service
+			newService.T = sa.T
+			delete(d.processPool, sa.SUID)
+			d.Unlock()
+
+			serviceChan.Push(newService)
+
+			l.Info("Starting service...")
+
+			started, err := d.waitStarted(sa.SUID, 5*time.Second)
+			if started == nil {
+				l.Error(err)
+				sa.Message = err.Error()
+				return sa
+			}
+			handler = started
+			if err != nil {
+				l.Errorf("Service did not start: %s", err)
+				sa.Message = fmt.Sprintf("service did not start: %s", err)
+			}
+			sa.Status, sa.PID = d.handlerStatus(handler)
+		}
+	}
+
+	d.Lock()
+	sa.ExitTime = handler.exitTime
+	sa.StartTime = handler.startTime
+	sa.ExitStatus = handler.exitStatus
+	sa.Error = handler.err
+	sa.StopResult = handler.stopResult
+	sa.Argv = handler.argv
+	health := handler.health
+	d.Unlock()
+	if stopResult != "" {
+		sa.StopResult = stopResult
+	}
+	sa.Restarts, sa.NextRestart, sa.RestartHistory = d.restartInfo(sa.SUID)
+	if health != nil && sa.Status == "running" {
+		sa.Health, _ = health.get()
+	}
+	if sa.Status == "running" {
+		sa.Usage, _ = d.cgroups.Usage(sa.Name)
+	}
+
+	return sa
+}
+
+// handlerStatus returns the status of the process of a handler and its pid while it runs
+func (d *ProcessOperator) handlerStatus(handler *ProcessHandler) (string, string) {
+	d.Lock()
+	exited := handler.exitTime != nil
+	pid := -1
+	if handler.process != nil {
+		pid = handler.process.Pid
+	}
+	d.Unlock()
+
+	switch {
+	case !exited:
+		return "running", fmt.Sprintf("%d", pid)
+	case isOneshot(handler.service):
+		return handler.oneshotStatus(), ""
+	case d.gaveUp(handler.service.SUID):
+		return "failed", ""
+	}
+	return "stopped", ""
+}
+
+const (
+	// defaultLogTail and maxLogSize bound the output returned by the logs action, which is
+	// sent in one reply. Longer output is read from the log stream endpoints
+	defaultLogTail = 1000
+	maxLogSize     = 1 << 20
+)
+
+// logsAction returns the output of a service, or of all its replicas, in the log of the
+// action. Without a tail the last defaultLogTail lines of every log are returned, and the
+// output is cut to its last maxLogSize bytes
+func (d *ProcessOperator) logsAction(sa *models.ServiceAction) {
+	names := []string{sa.Name}
+	if set := d.replicaSet(sa.SUID); set != nil {
+		d.Lock()
+		names = names[:0]
+		for i := 0; i < set.count; i++ {
+			names = append(names, fmt.Sprintf("%s-%d", set.service.Name, i))
+		}
+		d.Unlock()
+	}
+
+	opts := logs.ReadOptions{
+		Stream: logs.Stdout,
+		Tail:   sa.Tail,
+	}
+	if opts.Tail <= 0 {
+		opts.Tail = defaultLogTail
+	}
+	if sa.Stderr {
+		opts.Stream = logs.Stderr
+	}
+	if sa.Since != nil {
+		opts.Since = *sa.Since
+	}
+
+	buf := newLastBytes(maxLogSize)
+	err := d.logs.Stream(context.Background(), names, opts, buf)
+	sa.Log = buf.bytes()
+	if err != nil {
+		sa.Message = fmt.Sprintf("could not read logs: %s", err)
+	} else if buf.cut {
+		sa.Message = fmt.Sprintf("log cut to its last %d bytes, read the log stream for all of it", maxLogSize)
+	}
+}
+
+// lastBytes keeps the last max bytes written to it
+type lastBytes struct {
+	max int
+	buf []byte
+	// cut is set once bytes have been dropped, prev is the last byte dropped
+	cut  bool
+	prev byte
+}
+
+func newLastBytes(max int) *lastBytes {
+	return &lastBytes{max: max}
+}
+
+func (b *lastBytes) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	// Cut at twice the size, so that the buffer is not copied on every write
+	if len(b.buf) > 2*b.max {
+		b.drop(len(b.buf) - b.max)
+	}
+	return len(p), nil
+}
+
+func (b *lastBytes) drop(n int) {
+	b.prev = b.buf[n-1]
+	b.buf = append(b.buf[:0], b.buf[n:]...)
+	b.cut = true
+}
+
+// bytes returns the last max bytes written. Output that has been cut starts at the first
+// whole line
+func (b *lastBytes) bytes() []byte {
+	if len(b.buf) > b.max {
+		b.drop(len(b.buf) - b.max)
+	}
+	if b.cut && b.prev != '\n' {
+		if i := bytes.IndexByte(b.buf, '\n'); i >= 0 {
+			return b.buf[i+1:]
+		}
+		return nil
+	}
+	return b.buf
+}
+
+// waitStarted waits for the process handler of a service to be added to the pool and for
+// its process to start. It returns the handler, if it has been added, and an error if the
+// process did not start within timeout, could not be started or has exited already. A
+// oneshot service that has exited has run, whether it succeeded or not
+func (d *ProcessOperator) waitStarted(suid string, timeout time.Duration) (*ProcessHandler, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var started, exited, oneshot bool
+		var err error
+		var exitStatus string
+
+		d.Lock()
+		handler := d.processPool[suid]
+		if handler != nil {
+			started = handler.startTime != nil
+			exited = handler.exitTime != nil
+			oneshot = isOneshot(handler.service)
+			err = handler.err
+			exitStatus = handler.exitStatus
+		}
+		d.Unlock()
+
+		switch {
+		case started && err != nil:
+			return handler, err
+		case started && exited && !oneshot:
+			return handler, fmt.Errorf("exited right after it started: %s", exitStatus)
+		case started:
+			return handler, nil
+		case time.Now().After(deadline) && handler == nil:
+			return nil, fmt.Errorf("done waiting for service to be added in the pool")
+		case time.Now().After(deadline):
+			return handler, fmt.Errorf("done waiting for service to start")
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+}
+
+// removeCgroup deletes the cgroup of a deleted service
+func (d *ProcessOperator) removeCgroup(name string) {
+	if err := d.cgroups.Remove(name); err != nil {
+		d.logger.WithFields(logrus.Fields{
+			"Component": "ProcessPoolManager",
+			"Part":      "TaskOperator",
+			"Name":      name,
+		}).Warnf("Could not remove service cgroup: %s", err)
+	}
+}
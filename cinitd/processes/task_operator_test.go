@@ -0,0 +1,161 @@
+package processes
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func TestWaitStarted(t *testing.T) {
+	now := time.Now()
+	web := models.Service{Name: "web", SUID: "web"}
+	tests := []struct {
+		name    string
+		handler *ProcessHandler
+		err     string
+	}{
+		{name: "not added", err: "done waiting for service to be added in the pool"},
+		{name: "not started", handler: &ProcessHandler{service: web}, err: "done waiting for service to start"},
+		{name: "running", handler: &ProcessHandler{service: web, startTime: &now, process: &os.Process{Pid: 10}}},
+		{
+			name:    "exec failed",
+			handler: &ProcessHandler{service: web, startTime: &now, exitTime: &now, err: errors.New("exec: not found")},
+			err:     "exec: not found",
+		},
+		{
+			name:    "exited",
+			handler: &ProcessHandler{service: web, startTime: &now, exitTime: &now, exitStatus: "exit status 1"},
+			err:     "exited right after it started: exit status 1",
+		},
+		{
+			name: "oneshot completed",
+			handler: &ProcessHandler{
+				service:   models.Service{Name: "init", SUID: "web", ServiceType: "oneshot"},
+				startTime: &now,
+				exitTime:  &now,
+			},
+		},
+	}
+	for _, tt := range tests {
+		d := newTestOperator()
+		d.processPool = make(map[string]*ProcessHandler)
+		if tt.handler != nil {
+			d.processPool["web"] = tt.handler
+		}
+
+		handler, err := d.waitStarted("web", 50*time.Millisecond)
+		if handler != tt.handler {
+			t.Errorf("%s: got handler %p, want %p", tt.name, handler, tt.handler)
+		}
+		if got := fmt.Sprint(err); (err != nil || tt.err != "") && got != tt.err {
+			t.Errorf("%s: got error %q, want %q", tt.name, got, tt.err)
+		}
+	}
+}
+
+func TestStartActionReportsFailedStart(t *testing.T) {
+	d := newTestOperator()
+	d.serviceChan = channels.NewServiceChannel(1, 1)
+	now := time.Now()
+	service := models.Service{Name: "web", SUID: "web", Command: "/nonexistent/web"}
+	d.processPool = map[string]*ProcessHandler{
+		"web": {service: service, startTime: &now, exitTime: &now, exitStatus: "exit status 1"},
+	}
+
+	// The pushed service fails to start
+	go func() {
+		s := <-d.serviceChan.Data
+		failed := time.Now()
+		d.Lock()
+		d.processPool[s.SUID] = &ProcessHandler{
+			service:   s,
+			process:   &os.Process{Pid: -1},
+			startTime: &failed,
+			exitTime:  &failed,
+			err:       errors.New("exec: not found"),
+		}
+		d.Unlock()
+	}()
+
+	sa := d.serviceAction(models.ServiceAction{T: "start", Name: "web", SUID: "web"}, d.serviceChan, logrus.NewEntry(d.logger))
+	if sa.Status != "stopped" || sa.PID != "" {
+		t.Errorf("failed start has status %s and pid %q", sa.Status, sa.PID)
+	}
+	if sa.Message != "service did not start: exec: not found" {
+		t.Errorf("message is %q", sa.Message)
+	}
+}
+
+func TestLastBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+		cut    bool
+	}{
+		{name: "short", writes: []string{"a\n", "b\n"}, want: "a\nb\n"},
+		{name: "exact", writes: []string{"abcd\n", "efgh\n"}, want: "abcd\nefgh\n"},
+		{name: "cut in a line", writes: []string{"abcd\n", "efgh\n", "ij\n"}, want: "efgh\nij\n", cut: true},
+		{name: "cut at a line", writes: []string{"abc\n", "efgh\n", "ijkl\n"}, want: "efgh\nijkl\n", cut: true},
+		{name: "cut many times", writes: []string{"a\n", "bbbbbbbbbbbbbbbbbbbbbbbbb\n", "c\n", "d\n"}, want: "c\nd\n", cut: true},
+		{name: "one long line", writes: []string{"abcdefghijklmnopqrstuvwxyz\n"}, want: "", cut: true},
+	}
+	for _, tt := range tests {
+		b := newLastBytes(10)
+		for _, w := range tt.writes {
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("%s: Write returned %d, %v", tt.name, n, err)
+			}
+		}
+		if got := string(b.bytes()); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if b.cut != tt.cut {
+			t.Errorf("%s: cut is %v, want %v", tt.name, b.cut, tt.cut)
+		}
+	}
+}
+
+func TestLogsActionIsBounded(t *testing.T) {
+	m := logs.NewManager(t.TempDir(), nil, logs.TargetFile, nil)
+	var log strings.Builder
+	for i := 0; i < 2*defaultLogTail; i++ {
+		fmt.Fprintf(&log, "line %d\n", i)
+	}
+	if err := ioutil.WriteFile(m.Path("web", logs.Stdout), []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &ProcessOperator{logs: m}
+
+	sa := &models.ServiceAction{Name: "web", SUID: "web"}
+	d.logsAction(sa)
+	lines := strings.Split(strings.TrimSuffix(string(sa.Log), "\n"), "\n")
+	if len(lines) != defaultLogTail || lines[0] != fmt.Sprintf("line %d", defaultLogTail) {
+		t.Errorf("got %d lines starting with %q, want the last %d", len(lines), lines[0], defaultLogTail)
+	}
+
+	sa = &models.ServiceAction{Name: "web", SUID: "web", Tail: 5}
+	d.logsAction(sa)
+	if want := "line 1995\nline 1996\nline 1997\nline 1998\nline 1999\n"; string(sa.Log) != want {
+		t.Errorf("tail 5: got %q", sa.Log)
+	}
+
+	long := strings.Repeat("x", maxLogSize) + "\nlast\n"
+	if err := ioutil.WriteFile(m.Path("web", logs.Stdout), []byte(long), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sa = &models.ServiceAction{Name: "web", SUID: "web"}
+	d.logsAction(sa)
+	if string(sa.Log) != "last\n" || sa.Message == "" {
+		t.Errorf("got %d bytes of log and message %q, want the output cut", len(sa.Log), sa.Message)
+	}
+}
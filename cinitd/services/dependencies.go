@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	dependencyPollInterval = 250 * time.Millisecond
+	dependencyLogInterval  = 30 * time.Second
+)
+
+// dependencyGraph returns the dependsOn lists of the registered services
+func (d *ServiceOperator) dependencyGraph() map[string][]string {
+	d.Lock()
+	defer d.Unlock()
+	return d.dependencyGraphLocked()
+}
+
+// dependencyGraphLocked is dependencyGraph for callers holding the lock
+func (d *ServiceOperator) dependencyGraphLocked() map[string][]string {
+	graph := make(map[string][]string)
+	for name, j := range d.services {
+		graph[name] = j.DependsOn
+	}
+	return graph
+}
+
+// checkDependencies validates the dependsOn list of a service against a dependency
+// graph. The registered services are acyclic, so a new cycle has to go through s
+func checkDependencies(graph map[string][]string, s *models.Service) error {
+	graph[s.Name] = s.DependsOn
+
+	for _, dep := range s.DependsOn {
+		if dep == "" {
+			return fmt.Errorf("service %s: dependsOn entries can not be empty", s.Name)
+		}
+		if dep == s.Name {
+			return fmt.Errorf("service %s: a service can not depend on itself", s.Name)
+		}
+		if path := dependencyPath(graph, dep, s.Name, nil); path != nil {
+			cycle := append([]string{s.Name}, path...)
+			return fmt.Errorf("service %s: dependency cycle %s", s.Name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	return nil
+}
+
+// dependencyPath returns the dependency path from one service to another, or nil if
+// there is none
+func dependencyPath(graph map[string][]string, from, to string, visited map[string]bool) []string {
+	if from == to {
+		return []string{to}
+	}
+	if visited == nil {
+		visited = make(map[string]bool)
+	}
+	if visited[from] {
+		return nil
+	}
+	visited[from] = true
+
+	for _, next := range graph[from] {
+		if path := dependencyPath(graph, next, to, visited); path != nil {
+			return append([]string{from}, path...)
+		}
+	}
+	return nil
+}
+
+// dependents returns the registered services that depend on name
+func (d *ServiceOperator) dependents(name string) []string {
+	d.Lock()
+	defer d.Unlock()
+	dependents := make([]string, 0)
+	for k, j := range d.services {
+		for _, dep := range j.DependsOn {
+			if dep == name {
+				dependents = append(dependents, k)
+			}
+		}
+	}
+	return dependents
+}
+
+// dependenciesReady reports whether all dependencies of a service are running, and healthy
+// if they have a health check. Oneshot dependencies must have completed and scheduled
+// dependencies must have been scheduled. The first
+// dependency that is not ready is returned along with the reason
+func (d *ServiceOperator) dependenciesReady(s models.Service, serviceChan *channels.Service) (bool, string) {
+	for _, dep := range s.DependsOn {
+		depService, ok := d.service(dep)
+		if !ok {
+			return false, fmt.Sprintf("%s is not registered", dep)
+		}
+
+		si, err := d.action(&models.Service{T: "status", Name: dep}, serviceChan)
+		if err != nil {
+			return false, fmt.Sprintf("%s: %s", dep, err)
+		}
+		if depService.Schedule != "" {
+			if si.Status == "stopped" || si.Status == "waiting" {
+				return false, fmt.Sprintf("%s is %s", dep, si.Status)
+			}
+			continue
+		}
+		if depService.ServiceType == "oneshot" {
+			if si.Status != "completed" {
+				return false, fmt.Sprintf("%s is %s", dep, si.Status)
+			}
+			continue
+		}
+		if si.Status != "running" {
+			return false, fmt.Sprintf("%s is %s", dep, si.Status)
+		}
+		if depService.HealthCheck != nil && si.Health != "healthy" {
+			return false, fmt.Sprintf("%s is %s", dep, si.Health)
+		}
+	}
+	return true, ""
+}
+
+// startWhenReady pushes a service to the ProcessOperator once all its dependencies are
+// running. Waiting happens in the background and stops if the service is deleted or
+// stopped in the meantime, or if cinitd is shutting down
+func (d *ServiceOperator) startWhenReady(ctx context.Context, s models.Service, serviceChan *channels.Service) {
+	if len(s.DependsOn) == 0 {
+		serviceChan.Push(s)
+		return
+	}
+
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ServiceOperator",
+		"Part":      "Dependencies",
+		"Name":      s.Name,
+	})
+
+	waitCtx, cancel := context.WithCancel(ctx)
+
+	d.Lock()
+	d.pending[s.Name] = cancel
+	d.Unlock()
+
+	d.pendingWG.Add(1)
+	go func() {
+		defer d.pendingWG.Done()
+		defer func() {
+			cancel()
+			d.Lock()
+			delete(d.pending, s.Name)
+			d.Unlock()
+		}()
+
+		log.Infof("Waiting for dependencies %s", strings.Join(s.DependsOn, ", "))
+		lastLog := time.Now()
+		for {
+			ready, reason := d.dependenciesReady(s, serviceChan)
+			if ready {
+				break
+			}
+
+			if time.Since(lastLog) > dependencyLogInterval {
+				log.Infof("Still waiting for dependencies: %s", reason)
+				lastLog = time.Now()
+			}
+
+			select {
+			case <-waitCtx.Done():
+				log.Info("Stopped waiting for dependencies")
+				return
+			case <-time.After(dependencyPollInterval):
+			}
+		}
+
+		// The replicas may have been scaled while waiting
+		if service, ok := d.service(s.Name); ok {
+			s.Replicas = service.Replicas
+		}
+		serviceChan.Push(s)
+	}()
+}
+
+// isPending reports whether a service is waiting for its dependencies
+func (d *ServiceOperator) isPending(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.pending[name] != nil
+}
+
+// cancelPending stops waiting for the dependencies of a service
+func (d *ServiceOperator) cancelPending(name string) {
+	d.Lock()
+	if cancel := d.pending[name]; cancel != nil {
+		cancel()
+	}
+	d.Unlock()
+}
+
+// dependencyAction handles the parts of a service action that depend on the dependency
+// graph. It returns a reply when the action has been fully handled here, or an error if
+// the action is not allowed
+func (d *ServiceOperator) dependencyAction(s *models.Service, serviceChan *channels.Service) ([]byte, error) {
+	service, ok := d.service(s.Name)
+	if !ok {
+		return nil, nil
+	}
+
+	switch s.T {
+	case "delete":
+		if dependents := d.dependents(s.Name); len(dependents) > 0 {
+			return nil, fmt.Errorf("service %s is required by %s", s.Name, strings.Join(dependents, ", "))
+		}
+		d.cancelPending(s.Name)
+	case "stop":
+		d.cancelPending(s.Name)
+	case "start", "restart":
+		if d.isPending(s.Name) {
+			return nil, fmt.Errorf("service %s is already waiting for its dependencies", s.Name)
+		}
+		if ready, reason := d.dependenciesReady(service, serviceChan); !ready {
+			return nil, fmt.Errorf("service %s can not start: dependency %s", s.Name, reason)
+		}
+
+		// A service that never left the dependency wait is unknown to the ProcessOperator
+		si, err := d.action(&models.Service{T: "status", Name: s.Name}, serviceChan)
+		if err != nil {
+			return nil, err
+		}
+		if si.StartTime == nil && si.ExitTime == nil {
+			serviceChan.Push(service)
+			return json.Marshal(models.ServiceAction{
+				T:      s.T,
+				Name:   s.Name,
+				Status: "starting",
+			})
+		}
+	case "scale":
+		if service.Replicas == 0 {
+			return nil, fmt.Errorf("service %s can not be scaled: replicas is not set in its definition", s.Name)
+		}
+		if s.Replicas < 1 {
+			return nil, fmt.Errorf("service %s: replicas must be at least 1", s.Name)
+		}
+
+		// The new count is used once the service leaves the dependency wait
+		if d.isPending(s.Name) {
+			d.Lock()
+			d.services[s.Name].Replicas = s.Replicas
+			d.Unlock()
+			return json.Marshal(models.ServiceAction{
+				T:        s.T,
+				Name:     s.Name,
+				Status:   "waiting",
+				Replicas: s.Replicas,
+			})
+		}
+	case "status":
+		if d.isPending(s.Name) {
+			return json.Marshal(models.ServiceAction{
+				T:      s.T,
+				Name:   s.Name,
+				Status: "waiting",
+			})
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+// answerActions replies to the actions the ServiceOperator sends to the ProcessOperator
+// with the status of the service in statuses
+func answerActions(t *testing.T, d *ServiceOperator, statuses map[string]models.ServiceAction) *sync.Mutex {
+	t.Helper()
+	var mu sync.Mutex
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		for {
+			select {
+			case siChan := <-d.serviceChan.Action:
+				si := <-siChan
+				mu.Lock()
+				reply := statuses[si.Name]
+				mu.Unlock()
+				reply.T, reply.Name = si.T, si.Name
+				siChan <- reply
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return &mu
+}
+
+func TestCheckDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		dependsOn []string
+		err       string
+	}{
+		{name: "api", dependsOn: []string{"db", "web"}},
+		// Dependencies may be registered later
+		{name: "api", dependsOn: []string{"queue"}},
+		{name: "api", dependsOn: []string{"api"}, err: "service api: a service can not depend on itself"},
+		{name: "api", dependsOn: []string{"db", ""}, err: "service api: dependsOn entries can not be empty"},
+		{name: "db", dependsOn: []string{"web"}, err: "service db: dependency cycle db -> web -> db"},
+		{name: "db", dependsOn: []string{"proxy"}, err: "service db: dependency cycle db -> proxy -> web -> db"},
+	}
+	for _, tt := range tests {
+		graph := map[string][]string{
+			"db":    nil,
+			"web":   {"db"},
+			"proxy": {"web", "db"},
+		}
+		err := checkDependencies(graph, &models.Service{Name: tt.name, DependsOn: tt.dependsOn})
+		if got := errString(err); got != tt.err {
+			t.Errorf("%s %v: got error %q, want %q", tt.name, tt.dependsOn, got, tt.err)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestDependenciesReady(t *testing.T) {
+	d, _ := newTestServiceOperator(t)
+	answerActions(t, d, map[string]models.ServiceAction{
+		"db":        {Status: "running"},
+		"stopped":   {Status: "stopped"},
+		"healthy":   {Status: "running", Health: "healthy"},
+		"starting":  {Status: "running", Health: "starting"},
+		"migrated":  {Status: "completed"},
+		"migrating": {Status: "running"},
+		"cron":      {Status: "scheduled"},
+		"paused":    {Status: "stopped"},
+	})
+	healthCheck := &models.HealthCheck{TCP: "localhost:5432"}
+	d.services = map[string]*models.Service{
+		"db":        {Name: "db"},
+		"stopped":   {Name: "stopped"},
+		"healthy":   {Name: "healthy", HealthCheck: healthCheck},
+		"starting":  {Name: "starting", HealthCheck: healthCheck},
+		"migrated":  {Name: "migrated", ServiceType: "oneshot"},
+		"migrating": {Name: "migrating", ServiceType: "oneshot"},
+		"cron":      {Name: "cron", Schedule: "@hourly"},
+		"paused":    {Name: "paused", Schedule: "@hourly"},
+	}
+
+	tests := []struct {
+		dependsOn []string
+		reason    string
+	}{
+		{},
+		{dependsOn: []string{"db", "healthy", "migrated", "cron"}},
+		{dependsOn: []string{"db", "missing"}, reason: "missing is not registered"},
+		{dependsOn: []string{"stopped"}, reason: "stopped is stopped"},
+		{dependsOn: []string{"starting"}, reason: "starting is starting"},
+		{dependsOn: []string{"migrating"}, reason: "migrating is running"},
+		{dependsOn: []string{"paused"}, reason: "paused is stopped"},
+	}
+	for _, tt := range tests {
+		ready, reason := d.dependenciesReady(models.Service{Name: "web", DependsOn: tt.dependsOn}, d.serviceChan)
+		if ready != (tt.reason == "") || reason != tt.reason {
+			t.Errorf("%v: got %v, %q, want reason %q", tt.dependsOn, ready, reason, tt.reason)
+		}
+	}
+}
+
+func TestStartWhenReady(t *testing.T) {
+	d, pushed := newTestServiceOperator(t)
+	statuses := map[string]models.ServiceAction{"db": {Status: "stopped"}}
+	mu := answerActions(t, d, statuses)
+
+	for _, s := range []models.Service{
+		{Name: "db", Command: "postgres"},
+		{Name: "web", Command: "web", DependsOn: []string{"db"}, Replicas: 1},
+	} {
+		s := s
+		if err := d.register(d.ctx, &s, d.serviceChan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if started := receive(pushed); len(started) != 1 || started["db"] == "" {
+		t.Fatalf("started %v before db was running", started)
+	}
+	if !d.isPending("web") {
+		t.Fatal("web is not waiting for db")
+	}
+
+	// Actions on a waiting service are answered by the ServiceOperator
+	reply, err := d.dependencyAction(&models.Service{T: "status", Name: "web"}, d.serviceChan)
+	if err != nil || !strings.Contains(string(reply), `"status":"waiting"`) {
+		t.Errorf("status of web is %s, %v", reply, err)
+	}
+	if _, err := d.dependencyAction(&models.Service{T: "start", Name: "web"}, d.serviceChan); err == nil {
+		t.Error("web was started while it waits")
+	}
+	if _, err := d.dependencyAction(&models.Service{T: "delete", Name: "db"}, d.serviceChan); errString(err) != "service db is required by web" {
+		t.Errorf("deleting db returned %v", err)
+	}
+	if _, err := d.dependencyAction(&models.Service{T: "scale", Name: "web", Replicas: 3}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	statuses["db"] = models.ServiceAction{Status: "running"}
+	mu.Unlock()
+	select {
+	case s := <-pushed:
+		if s.Name != "web" || s.Replicas != 3 {
+			t.Errorf("started %s with %d replicas, want web with 3", s.Name, s.Replicas)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("web was not started once db was running")
+	}
+}
+
+func TestStopWaiting(t *testing.T) {
+	d, pushed := newTestServiceOperator(t)
+	answerActions(t, d, map[string]models.ServiceAction{"db": {Status: "stopped"}})
+	d.services["db"] = &models.Service{Name: "db"}
+
+	if err := d.register(d.ctx, &models.Service{Name: "web", Command: "web", DependsOn: []string{"db"}}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.dependencyAction(&models.Service{T: "stop", Name: "web"}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+	d.pendingWG.Wait()
+	if d.isPending("web") || len(receive(pushed)) != 0 {
+		t.Error("web is still waiting after it was stopped")
+	}
+}
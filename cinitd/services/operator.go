@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/ulfox/cinit/cinitd/channels"
 	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/state"
 )
 
 // ServiceOperator for managing cinitd services
@@ -20,6 +22,21 @@ type ServiceOperator struct {
 	exitSO   <-chan bool
 	ready    chan bool
 	services map[string]*models.Service
+
+	pending   map[string]context.CancelFunc
+	pendingWG sync.WaitGroup
+
+	// actionLocks serialize the actions that change the state of a service
+	actionLocks map[string]*sync.Mutex
+
+	// store keeps the registered services across restarts of cinitd. stored holds the
+	// services of the store that have not been registered again yet
+	store    *state.Store
+	stored   map[string]state.Entry
+	disabled map[string]bool
+
+	ctx         context.Context
+	serviceChan *channels.Service
 }
 
 // NewProcessOperator creates, and returns a new ServiceOperator
@@ -29,6 +46,11 @@ func NewProcessOperator(exitSO <-chan bool, logger *logrus.Logger) *ServiceOpera
 		exitSO:   exitSO,
 		ready:    make(chan bool),
 		services: make(map[string]*models.Service),
+		pending:  make(map[string]context.CancelFunc),
+		stored:   make(map[string]state.Entry),
+		disabled: make(map[string]bool),
+
+		actionLocks: make(map[string]*sync.Mutex),
 	}
 }
 
@@ -72,6 +94,7 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 					case args = <-r:
 						break rLoop
 					case <-time.After(10 * time.Second):
+						remote.Timeout()
 						l.Error("Done waiting for client")
 						return
 					}
@@ -84,12 +107,8 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 					return
 				}
 
-				if s.T == "shutdown" {
-					return
-				}
-
 				allowedTypes := []string{
-					"restart", "start", "register", "stop", "status", "delete", "list",
+					"restart", "start", "register", "stop", "status", "delete", "list", "reload", "signal", "scale", "logs",
 				}
 				var typeOK bool
 				for _, j := range allowedTypes {
@@ -104,19 +123,32 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 
 				switch s.T {
 				case "register":
-					if d.services[s.Name] != nil {
-						msg := fmt.Sprintf("service %s already exists", s.Name)
-						l.Errorf(msg)
-						r <- []byte(msg)
+					if err := d.register(ctx, s, serviceChan); err != nil {
+						l.Error(err)
+						r <- []byte(err.Error())
 						break
 					}
-					s.SUID = uuid.New().String()
-					serviceChan.Push(*s)
 
 					r <- []byte("Service " + s.Name + " has been registered")
-					d.services[s.Name] = s
-				case "status", "delete", "stop", "start":
-					data, err := d.serviceAction(s, serviceChan)
+				case "status", "delete", "stop", "start", "restart", "reload", "signal", "scale", "logs":
+					if s.T != "status" && s.T != "logs" {
+						unlock := d.lockService(s.Name)
+						defer unlock()
+					}
+
+					data, err := d.dependencyAction(s, serviceChan)
+					if err != nil {
+						r <- []byte(err.Error())
+						l.Error(err)
+						break
+					}
+					if data != nil {
+						d.recordAction(s)
+						r <- data
+						break
+					}
+
+					data, err = d.serviceAction(s, serviceChan)
 					if err != nil {
 						r <- []byte(err.Error())
 						l.Error(err)
@@ -124,15 +156,26 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 					}
 
 					if s.T == "delete" {
+						d.Lock()
 						delete(d.services, s.Name)
+						d.Unlock()
+					}
+
+					if s.T == "scale" {
+						d.Lock()
+						d.services[s.Name].Replicas = s.Replicas
+						d.Unlock()
 					}
 
+					d.recordAction(s)
 					r <- data
 				case "list":
 					var serviceList struct{ Services []string }
+					d.Lock()
 					for k := range d.services {
 						serviceList.Services = append(serviceList.Services, k)
 					}
+					d.Unlock()
 					if len(serviceList.Services) == 0 {
 						r <- []byte("No services")
 						return
@@ -150,6 +193,7 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 			}(rChan, &serviceWG, log)
 		case <-ctx.Done():
 			serviceWG.Wait()
+			d.pendingWG.Wait()
 			wg.Done()
 			log.Infof("Bye!")
 			return
@@ -159,17 +203,261 @@ func (d *ServiceOperator) serviceListener(ctx context.Context, remote *channels.
 	}
 }
 
+// register validates a service and hands it over to the ProcessOperator, once its
+// dependencies are running
+func (d *ServiceOperator) register(ctx context.Context, s *models.Service, serviceChan *channels.Service) error {
+	if err := d.validateService(s); err != nil {
+		return err
+	}
+
+	s.SUID = uuid.New().String()
+
+	d.Lock()
+	if d.services[s.Name] != nil {
+		d.Unlock()
+		return fmt.Errorf("service %s already exists", s.Name)
+	}
+	if err := checkDependencies(d.dependencyGraphLocked(), s); err != nil {
+		d.Unlock()
+		return err
+	}
+	if entry, ok := d.stored[s.Name]; ok {
+		if entry.Service.SUID != "" {
+			s.SUID = entry.Service.SUID
+		}
+		// Services with restart policy always are started on boot even if they have been
+		// stopped, unless-stopped ones stay stopped
+		if !entry.Enabled && s.Restart != "always" {
+			d.disabled[s.Name] = true
+		}
+		delete(d.stored, s.Name)
+	}
+	d.services[s.Name] = s
+	disabled := d.disabled[s.Name]
+	d.Unlock()
+
+	d.persist()
+	if disabled {
+		d.logger.WithFields(logrus.Fields{
+			"Component": "ServiceOperator",
+			"Part":      "Register",
+			"Name":      s.Name,
+		}).Info("Service has been stopped before the restart of cinitd, not starting it")
+		return nil
+	}
+	d.startWhenReady(ctx, *s, serviceChan)
+	return nil
+}
+
+// UseStore makes the ServiceOperator keep the registered services in store. Services
+// registered later on reuse the SUID and the enabled state they have in the store
+func (d *ServiceOperator) UseStore(store *state.Store) error {
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.store = store
+	for _, entry := range entries {
+		d.stored[entry.Service.Name] = entry
+	}
+	return nil
+}
+
+// Restore registers the services of the store that have not been registered from the
+// definitions loaded on boot. Services that fail to register are kept in the store
+func (d *ServiceOperator) Restore() {
+	log := d.logger.WithFields(logrus.Fields{
+		"Component": "ServiceOperator",
+		"Part":      "Restore",
+	})
+
+	d.Lock()
+	names := make([]string, 0, len(d.stored))
+	for name := range d.stored {
+		names = append(names, name)
+	}
+	d.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		d.Lock()
+		entry, ok := d.stored[name]
+		d.Unlock()
+		if !ok {
+			continue
+		}
+
+		s := entry.Service
+		s.T = "register"
+		if err := d.register(d.ctx, &s, d.serviceChan); err != nil {
+			log.Errorf("Could not restore service %s: %s", name, err)
+			continue
+		}
+		log.Infof("Service %s has been restored", name)
+	}
+}
+
+// recordAction updates the store after a successful service action. Stopped services
+// are disabled until they are started again
+func (d *ServiceOperator) recordAction(s *models.Service) {
+	d.Lock()
+	switch s.T {
+	case "stop":
+		d.disabled[s.Name] = true
+	case "start", "restart", "delete":
+		delete(d.disabled, s.Name)
+	case "scale":
+	default:
+		d.Unlock()
+		return
+	}
+	d.Unlock()
+
+	d.persist()
+}
+
+// persist writes the registered services to the store
+func (d *ServiceOperator) persist() {
+	if d.store == nil {
+		return
+	}
+
+	d.Lock()
+	entries := make([]state.Entry, 0, len(d.services)+len(d.stored))
+	for name, s := range d.services {
+		service := *s
+		service.T = "register"
+		entries = append(entries, state.Entry{
+			Service: service,
+			Enabled: !d.disabled[name],
+		})
+	}
+	for name, entry := range d.stored {
+		if d.services[name] == nil {
+			entries = append(entries, entry)
+		}
+	}
+	d.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Service.Name < entries[j].Service.Name
+	})
+	if err := d.store.Save(entries); err != nil {
+		d.logger.WithFields(logrus.Fields{
+			"Component": "ServiceOperator",
+			"Part":      "Store",
+		}).Errorf("Could not save %s: %s", d.store.Path(), err)
+	}
+}
+
+// Load validates a batch of service definitions and registers them through the same
+// path as the register action. Nothing is registered if any definition is invalid.
+// Errors are prefixed with the source of the failing definition
+func (d *ServiceOperator) Load(services []models.Service) error {
+	sourceErr := func(s *models.Service, err error) error {
+		if s.Source == "" {
+			return err
+		}
+		return fmt.Errorf("%s: %s", s.Source, err)
+	}
+
+	graph := d.dependencyGraph()
+	for i := range services {
+		s := &services[i]
+		if _, ok := graph[s.Name]; ok {
+			return sourceErr(s, fmt.Errorf("service %s already exists", s.Name))
+		}
+		if err := d.validateService(s); err != nil {
+			return sourceErr(s, err)
+		}
+		graph[s.Name] = s.DependsOn
+	}
+
+	for i := range services {
+		if err := checkDependencies(graph, &services[i]); err != nil {
+			return sourceErr(&services[i], err)
+		}
+	}
+
+	for i := range services {
+		s := services[i]
+		s.T = "register"
+		if err := d.register(d.ctx, &s, d.serviceChan); err != nil {
+			return sourceErr(&s, err)
+		}
+		d.logger.WithFields(logrus.Fields{
+			"Component": "ServiceOperator",
+			"Part":      "Load",
+			"Source":    s.Source,
+		}).Infof("Service %s has been registered", s.Name)
+	}
+
+	return nil
+}
+
+// service returns a copy of a registered service
+func (d *ServiceOperator) service(name string) (models.Service, bool) {
+	d.Lock()
+	defer d.Unlock()
+	s := d.services[name]
+	if s == nil {
+		return models.Service{}, false
+	}
+	return *s, true
+}
+
+// lockService waits for the running actions of a service to finish and blocks new ones
+// until the returned function is called. The lock of a service is kept after it is
+// deleted, so that actions on a service registered again under its name are serialized
+// with the ones still running
+func (d *ServiceOperator) lockService(name string) func() {
+	d.Lock()
+	l := d.actionLocks[name]
+	if l == nil {
+		l = &sync.Mutex{}
+		d.actionLocks[name] = l
+	}
+	d.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
 func (d *ServiceOperator) serviceAction(s *models.Service, serviceChan *channels.Service) ([]byte, error) {
-	if d.services[s.Name] == nil {
-		return nil, fmt.Errorf("Service " + s.Name + " does not exist")
+	si, err := d.action(s, serviceChan)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(si)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// action sends a service action to the ProcessOperator and waits for its reply
+func (d *ServiceOperator) action(s *models.Service, serviceChan *channels.Service) (models.ServiceAction, error) {
+	service, ok := d.service(s.Name)
+	if !ok {
+		return models.ServiceAction{}, fmt.Errorf("Service " + s.Name + " does not exist")
 	}
 	siChan := make(chan models.ServiceAction)
 	serviceChan.PushSA(siChan)
 
 	si := models.ServiceAction{
-		SUID: d.services[s.Name].SUID,
-		Name: s.Name,
-		T:    s.T,
+		SUID:        service.SUID,
+		Name:        s.Name,
+		T:           s.T,
+		Signal:      s.Signal,
+		SignalGroup: s.SignalGroup,
+		Replicas:    s.Replicas,
+		Tail:        s.Tail,
+		Since:       s.Since,
+		Stderr:      s.Stderr,
 	}
 
 	siChan <- si
@@ -179,16 +467,13 @@ saLoop:
 		case si = <-siChan:
 			break saLoop
 		case <-time.After(serviceChan.ActionTimeOut):
+			serviceChan.Timeout()
 			msg := "done waiting for a response from ProcessPoolManager"
-			return nil, fmt.Errorf(msg)
+			return models.ServiceAction{}, fmt.Errorf(msg)
 		}
 	}
 
-	data, err := json.Marshal(si)
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
+	return si, nil
 }
 
 // Init ServiceOperator to listen to remote service commands
@@ -200,6 +485,9 @@ func (d *ServiceOperator) Init(remote *channels.Remote, serviceChan *channels.Se
 	var serviceListenerWG sync.WaitGroup
 
 	ctxServiceListener, cancelServiceListener := context.WithCancel(context.Background())
+	d.ctx = ctxServiceListener
+	d.serviceChan = serviceChan
+
 	serviceListenerWG.Add(1)
 	go d.serviceListener(ctxServiceListener, remote, serviceChan, &serviceListenerWG)
 
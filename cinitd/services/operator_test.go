@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/channels"
+	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/state"
+)
+
+// newTestServiceOperator returns a ServiceOperator and a channel that receives the services
+// it pushes to the ProcessOperator
+func newTestServiceOperator(t *testing.T) (*ServiceOperator, chan models.Service) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	d := NewProcessOperator(nil, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.ctx = ctx
+	d.serviceChan = channels.NewServiceChannel(1, 1)
+
+	pushed := make(chan models.Service, 100)
+	go func() {
+		for {
+			select {
+			case s := <-d.serviceChan.Data:
+				pushed <- s
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		d.pendingWG.Wait()
+	})
+	return d, pushed
+}
+
+func TestRegisterConcurrently(t *testing.T) {
+	d, pushed := newTestServiceOperator(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- d.register(d.ctx, &models.Service{Name: "web", Command: "web"}, d.serviceChan)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var registered int
+	for err := range errs {
+		if err == nil {
+			registered++
+		} else if err.Error() != "service web already exists" {
+			t.Error(err)
+		}
+	}
+	if registered != 1 || len(pushed) != 1 {
+		t.Errorf("registered %d times and started %d times, want once", registered, len(pushed))
+	}
+}
+
+func TestLockServiceAfterDelete(t *testing.T) {
+	d, _ := newTestServiceOperator(t)
+	if err := d.register(d.ctx, &models.Service{Name: "web", Command: "web"}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service is deleted and registered again while an action still holds its lock
+	unlock := d.lockService("web")
+	d.Lock()
+	delete(d.services, "web")
+	d.Unlock()
+	if err := d.register(d.ctx, &models.Service{Name: "web", Command: "web"}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		defer d.lockService("web")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("action ran while another one held the lock of the service")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
+
+// receive returns the names and SUIDs of the services pushed to the ProcessOperator
+func receive(pushed chan models.Service) map[string]string {
+	started := make(map[string]string)
+	for {
+		select {
+		case s := <-pushed:
+			started[s.Name] = s.SUID
+		case <-time.After(100 * time.Millisecond):
+			return started
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store, err := state.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save([]state.Entry{
+		{Service: models.Service{Name: "db", SUID: "db-suid", Command: "postgres"}, Enabled: true},
+		{Service: models.Service{Name: "web", SUID: "web-suid", Command: "web", Restart: "unless-stopped"}},
+		{Service: models.Service{Name: "worker", SUID: "worker-suid", Command: "worker", Restart: "always"}},
+		{Service: models.Service{Name: "broken", SUID: "broken-suid"}, Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, pushed := newTestServiceOperator(t)
+	if err := d.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	// db is defined on boot as well, its definition wins but the SUID is kept
+	if err := d.Load([]models.Service{{Name: "db", Command: "postgres -N 10"}}); err != nil {
+		t.Fatal(err)
+	}
+	d.Restore()
+
+	// Stopped services stay stopped unless their restart policy is always
+	want := map[string]string{"db": "db-suid", "worker": "worker-suid"}
+	if started := receive(pushed); !reflect.DeepEqual(started, want) {
+		t.Errorf("started %v, want %v", started, want)
+	}
+	if s, ok := d.service("db"); !ok || s.Command != "postgres -N 10" || s.SUID != "db-suid" {
+		t.Errorf("db is registered as %+v", s)
+	}
+	if s, ok := d.service("web"); !ok || s.SUID != "web-suid" {
+		t.Errorf("web is registered as %+v", s)
+	}
+
+	// The service that could not be restored is kept in the store
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := make(map[string]bool)
+	for _, e := range entries {
+		enabled[e.Service.Name] = e.Enabled
+	}
+	wantEnabled := map[string]bool{"broken": true, "db": true, "web": false, "worker": true}
+	if !reflect.DeepEqual(enabled, wantEnabled) {
+		t.Errorf("stored %v, want %v", enabled, wantEnabled)
+	}
+}
+
+func TestPersistActions(t *testing.T) {
+	store, err := state.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := newTestServiceOperator(t)
+	if err := d.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.register(d.ctx, &models.Service{Name: "web", Command: "web"}, d.serviceChan); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action  string
+		enabled bool
+	}{
+		{action: "stop", enabled: false},
+		{action: "status", enabled: false},
+		{action: "start", enabled: true},
+		{action: "stop", enabled: false},
+		{action: "restart", enabled: true},
+	}
+	for _, tt := range tests {
+		d.recordAction(&models.Service{T: tt.action, Name: "web"})
+		entries, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Enabled != tt.enabled {
+			t.Errorf("after %s stored %+v, want enabled %v", tt.action, entries, tt.enabled)
+		}
+		if entries[0].Service.T != "register" {
+			t.Errorf("stored with type %q", entries[0].Service.T)
+		}
+	}
+
+	d.Lock()
+	delete(d.services, "web")
+	d.Unlock()
+	d.recordAction(&models.Service{T: "delete", Name: "web"})
+	if entries, err := store.Load(); err != nil || len(entries) != 0 {
+		t.Errorf("stored %+v, %v after delete", entries, err)
+	}
+}
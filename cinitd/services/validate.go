@@ -0,0 +1,257 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/ulfox/cinit/cinitd/cgroups"
+	"github.com/ulfox/cinit/cinitd/logs"
+	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/processes"
+	"github.com/ulfox/cinit/cinitd/utils"
+)
+
+// validateService checks a service definition before it is registered and resolves
+// the credentials the service will run with
+func (d *ServiceOperator) validateService(s *models.Service) error {
+	if s.Name == "" {
+		return fmt.Errorf("service name can not be empty")
+	}
+
+	if s.Command == "" {
+		return fmt.Errorf("service %s: command can not be empty", s.Name)
+	}
+
+	if s.WorkingDir != "" {
+		f, err := os.Stat(s.WorkingDir)
+		if err != nil {
+			return fmt.Errorf("service %s: workingDir: %s", s.Name, err)
+		}
+		if !f.IsDir() {
+			return fmt.Errorf("service %s: workingDir %s is not a directory", s.Name, s.WorkingDir)
+		}
+	}
+
+	if s.User != "" || s.Group != "" || len(s.SupplementaryGroups) > 0 {
+		cred, err := utils.ResolveCredential(s.User, s.Group, s.SupplementaryGroups)
+		if err != nil {
+			return fmt.Errorf("service %s: %s", s.Name, err)
+		}
+		s.Credential = cred
+	}
+
+	if s.Restart != "" {
+		var policyOK bool
+		for _, j := range processes.RestartPolicies() {
+			if j == s.Restart {
+				policyOK = true
+			}
+		}
+		if !policyOK {
+			return fmt.Errorf("service %s: restart: policy %s not supported", s.Name, s.Restart)
+		}
+	}
+
+	if b := s.Backoff; b != nil {
+		if b.Delay < 0 || b.MaxDelay < 0 || b.Window < 0 {
+			return fmt.Errorf("service %s: backoff: values can not be negative", s.Name)
+		}
+		if b.MaxRestarts < -1 {
+			return fmt.Errorf("service %s: backoff: maxRestarts must be -1 (unlimited) or more", s.Name)
+		}
+		if b.MaxDelay > 0 && b.Delay > b.MaxDelay {
+			return fmt.Errorf("service %s: backoff: delay %s is greater than maxDelay %s", s.Name, b.Delay, b.MaxDelay)
+		}
+	}
+
+	if s.ServiceType != "" {
+		var typeOK bool
+		for _, j := range processes.ServiceTypes() {
+			if j == s.ServiceType {
+				typeOK = true
+			}
+		}
+		if !typeOK {
+			return fmt.Errorf("service %s: type: %s not supported", s.Name, s.ServiceType)
+		}
+	}
+
+	if s.ServiceType == "oneshot" {
+		if s.Restart != "" && s.Restart != "no" && s.Restart != "on-failure" {
+			return fmt.Errorf("service %s: restart: policy %s not supported for oneshot services", s.Name, s.Restart)
+		}
+		if s.HealthCheck != nil {
+			return fmt.Errorf("service %s: healthCheck: not supported for oneshot services", s.Name)
+		}
+	} else if s.AbortOnFailure {
+		return fmt.Errorf("service %s: abortOnFailure: only supported for oneshot services", s.Name)
+	}
+
+	for _, c := range s.SuccessExitCodes {
+		if c < 0 || c > 255 {
+			return fmt.Errorf("service %s: successExitCodes: %d is not a valid exit code", s.Name, c)
+		}
+	}
+
+	if hc := s.HealthCheck; hc != nil {
+		if err := validateHealthCheck(hc); err != nil {
+			return fmt.Errorf("service %s: healthCheck: %s", s.Name, err)
+		}
+	}
+
+	if s.Resources != nil {
+		if err := cgroups.Validate(s.Resources); err != nil {
+			return fmt.Errorf("service %s: resources: %s", s.Name, err)
+		}
+	}
+
+	if s.StopSignal != "" {
+		if _, err := utils.ParseSignal(s.StopSignal); err != nil {
+			return fmt.Errorf("service %s: stopSignal: %s", s.Name, err)
+		}
+	}
+	if s.StopTimeout < 0 {
+		return fmt.Errorf("service %s: stopTimeout: can not be negative", s.Name)
+	}
+
+	if s.ReloadSignal != "" {
+		if len(s.ReloadCommand) > 0 {
+			return fmt.Errorf("service %s: only one of reloadSignal and reloadCommand can be set", s.Name)
+		}
+		if _, err := utils.ParseSignal(s.ReloadSignal); err != nil {
+			return fmt.Errorf("service %s: reloadSignal: %s", s.Name, err)
+		}
+	}
+
+	if len(s.ReloadCommand) > 0 && s.ReloadCommand[0] == "" {
+		return fmt.Errorf("service %s: reloadCommand: command can not be empty", s.Name)
+	}
+
+	if err := logs.Validate(s.LogRotation); err != nil {
+		return fmt.Errorf("service %s: logRotation: %s", s.Name, err)
+	}
+
+	if s.LogTarget != "" {
+		var targetOK bool
+		for _, j := range logs.Targets() {
+			if j == s.LogTarget {
+				targetOK = true
+			}
+		}
+		if !targetOK {
+			return fmt.Errorf("service %s: logTarget: %s not supported", s.Name, s.LogTarget)
+		}
+	}
+
+	if err := validateLimits(s); err != nil {
+		return fmt.Errorf("service %s: %s", s.Name, err)
+	}
+
+	if err := validateSchedule(s); err != nil {
+		return fmt.Errorf("service %s: %s", s.Name, err)
+	}
+
+	if s.Replicas < 0 {
+		return fmt.Errorf("service %s: replicas: can not be negative", s.Name)
+	}
+	if s.Replicas > 0 && s.Schedule != "" {
+		return fmt.Errorf("service %s: replicas: not supported for scheduled services", s.Name)
+	}
+
+	return nil
+}
+
+func validateLimits(s *models.Service) error {
+	for name, value := range s.Limits {
+		if _, _, err := processes.ParseRlimit(name, value); err != nil {
+			return fmt.Errorf("limits: %s (supported: %s)", err, strings.Join(processes.RlimitNames(), ", "))
+		}
+	}
+
+	if s.Nice != nil && (*s.Nice < -20 || *s.Nice > 19) {
+		return fmt.Errorf("nice: %d is not between -20 and 19", *s.Nice)
+	}
+	if s.OOMScoreAdj != nil && (*s.OOMScoreAdj < -1000 || *s.OOMScoreAdj > 1000) {
+		return fmt.Errorf("oomScoreAdj: %d is not between -1000 and 1000", *s.OOMScoreAdj)
+	}
+	for _, cpu := range s.CPUAffinity {
+		if cpu < 0 || cpu >= runtime.NumCPU() {
+			return fmt.Errorf("cpuAffinity: cpu %d does not exist", cpu)
+		}
+	}
+	return nil
+}
+
+func validateSchedule(s *models.Service) error {
+	if s.Schedule == "" {
+		if s.Overlap != "" || s.Jitter != 0 || s.RunHistory != 0 {
+			return fmt.Errorf("overlap, jitter and runHistory require a schedule")
+		}
+		return nil
+	}
+
+	if err := processes.ParseSchedule(s.Schedule); err != nil {
+		return fmt.Errorf("schedule: %s", err)
+	}
+
+	if s.Overlap != "" {
+		var overlapOK bool
+		for _, j := range processes.OverlapPolicies() {
+			if j == s.Overlap {
+				overlapOK = true
+			}
+		}
+		if !overlapOK {
+			return fmt.Errorf("overlap: policy %s not supported", s.Overlap)
+		}
+	}
+
+	if s.Jitter < 0 || s.RunHistory < 0 {
+		return fmt.Errorf("jitter and runHistory can not be negative")
+	}
+	if s.Restart != "" && s.Restart != "no" {
+		return fmt.Errorf("restart: policy %s not supported for scheduled services", s.Restart)
+	}
+	if s.HealthCheck != nil {
+		return fmt.Errorf("healthCheck: not supported for scheduled services")
+	}
+	if s.AbortOnFailure {
+		return fmt.Errorf("abortOnFailure: not supported for scheduled services")
+	}
+	return nil
+}
+
+func validateHealthCheck(hc *models.HealthCheck) error {
+	var probes int
+	if len(hc.Exec) > 0 {
+		probes++
+	}
+	if hc.HTTP != nil {
+		probes++
+		u, err := url.Parse(hc.HTTP.URL)
+		if err != nil {
+			return fmt.Errorf("http: %s", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("http: url %s must use http or https", hc.HTTP.URL)
+		}
+	}
+	if hc.TCP != "" {
+		probes++
+		if _, _, err := net.SplitHostPort(hc.TCP); err != nil {
+			return fmt.Errorf("tcp: %s", err)
+		}
+	}
+	if probes != 1 {
+		return fmt.Errorf("exactly one of exec, http and tcp must be set")
+	}
+
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.StartPeriod < 0 || hc.Retries < 0 || hc.RestartAfter < 0 {
+		return fmt.Errorf("values can not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestValidateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		service models.Service
+		err     bool
+	}{
+		{name: "none", service: models.Service{}},
+		{name: "limits", service: models.Service{Limits: map[string]string{"nofile": "1024:4096", "as": "unlimited"}}},
+		{name: "unknown limit", service: models.Service{Limits: map[string]string{"rss": "1"}}, err: true},
+		{name: "soft over hard", service: models.Service{Limits: map[string]string{"nproc": "2:1"}}, err: true},
+		{name: "bad value", service: models.Service{Limits: map[string]string{"core": "none"}}, err: true},
+		{name: "nice", service: models.Service{Nice: intPtr(-20)}},
+		{name: "nice too low", service: models.Service{Nice: intPtr(-21)}, err: true},
+		{name: "nice too high", service: models.Service{Nice: intPtr(20)}, err: true},
+		{name: "oomScoreAdj", service: models.Service{OOMScoreAdj: intPtr(1000)}},
+		{name: "oomScoreAdj out of range", service: models.Service{OOMScoreAdj: intPtr(-1001)}, err: true},
+		{name: "cpuAffinity", service: models.Service{CPUAffinity: []int{0}}},
+		{name: "missing cpu", service: models.Service{CPUAffinity: []int{runtime.NumCPU()}}, err: true},
+		{name: "negative cpu", service: models.Service{CPUAffinity: []int{-1}}, err: true},
+	}
+	for _, tt := range tests {
+		err := validateLimits(&tt.service)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.err)
+		}
+	}
+}
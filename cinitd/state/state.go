@@ -0,0 +1,128 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+const (
+	// Version is the version of the state file written by this cinitd. Files of a newer
+	// version are rejected
+	Version = 1
+
+	stateFile = "services.json"
+
+	// stateFileMode keeps the state file private to cinitd. It holds the env of services,
+	// including the values decoded from CINIT_SERVICE_ variables
+	stateFileMode = 0600
+)
+
+// Entry is a registered service. Disabled services have been stopped on request
+type Entry struct {
+	Service models.Service `json:"service"`
+	Enabled bool           `json:"enabled"`
+}
+
+type stateData struct {
+	Version  int     `json:"version"`
+	Services []Entry `json:"services"`
+}
+
+// Store keeps the registered services in a file under a directory, so that they survive
+// restarts of cinitd
+type Store struct {
+	sync.Mutex
+	path string
+}
+
+// Open returns the store under dir, creating dir if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{
+		path: filepath.Join(dir, stateFile),
+	}, nil
+}
+
+// Path returns the path of the state file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load reads the registered services. A missing state file holds no services
+func (s *Store) Load() ([]Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state stateData
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %s", s.path, err)
+	}
+	if state.Version < 1 || state.Version > Version {
+		return nil, fmt.Errorf("%s: version %d is not supported", s.path, state.Version)
+	}
+	return state.Services, nil
+}
+
+// Save replaces the registered services. The state file is written to a temporary file
+// that is synced and renamed over the old one, so a crash leaves either the old or the
+// new state. The file is only readable by the user of cinitd
+func (s *Store) Save(entries []Entry) error {
+	data, err := json.MarshalIndent(stateData{
+		Version:  Version,
+		Services: entries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), stateFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(stateFileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
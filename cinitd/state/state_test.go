@@ -0,0 +1,99 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Load()
+	if err != nil || entries != nil {
+		t.Fatalf("store without a state file loaded %v, %v", entries, err)
+	}
+
+	entries = []Entry{
+		{
+			Service: models.Service{
+				Name:    "db",
+				SUID:    "0c6e7a3e-5a2f-4c4e-9a53-5d6a7c2c1b10",
+				Command: "postgres",
+				Env:     map[string]string{"PASSWORD": "s3cret"},
+			},
+			Enabled: true,
+		},
+		{
+			Service: models.Service{Name: "web", SUID: "web-suid", Command: "web", Replicas: 3},
+		},
+	}
+	if err := store.Save(entries); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, entries) {
+		t.Errorf("loaded\n%+v\nwant\n%+v", loaded, entries)
+	}
+
+	// The state holds env values, only cinitd may read it
+	fi, err := os.Stat(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("state file has mode %s, want 0600", fi.Mode().Perm())
+	}
+
+	// Saving again replaces the state and leaves no temporary files behind
+	if err := store.Save(entries[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = store.Load(); err != nil || len(loaded) != 1 || loaded[0].Service.Name != "db" {
+		t.Errorf("loaded %+v, %v after saving one service", loaded, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != stateFile {
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("state dir holds %v", names)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{name: "newer version", data: `{"version": 2, "services": []}`},
+		{name: "no version", data: `{"services": []}`},
+		{name: "not json", data: `services:`},
+	}
+	for _, tt := range tests {
+		store, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(store.Path(), []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if entries, err := store.Load(); err == nil {
+			t.Errorf("%s: loaded %+v", tt.name, entries)
+		}
+	}
+}
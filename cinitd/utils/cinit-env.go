@@ -27,3 +27,17 @@ func GetCInitEnv() map[string]string {
 
 	return env
 }
+
+// GetPrefixedEnv returns the variables of environ that have the given prefix, keyed by
+// their full name
+func GetPrefixedEnv(prefix string) map[string]string {
+	env := make(map[string]string)
+	for _, b := range os.Environ() {
+		if strings.HasPrefix(b, prefix) {
+			pair := strings.SplitN(b, "=", 2)
+			env[pair[0]] = pair[1]
+		}
+	}
+
+	return env
+}
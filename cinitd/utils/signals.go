@@ -1,9 +1,14 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // OSSignalHandler for storing a signal
@@ -35,3 +40,22 @@ func (s *OSSignalHandler) Wait() {
 func (s *OSSignalHandler) Close() {
 	close(s.Signal)
 }
+
+// ParseSignal returns the signal of a name (SIGHUP or HUP) or number
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if unix.SignalName(syscall.Signal(n)) == "" {
+			return 0, fmt.Errorf("signal %d does not exist", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig := unix.SignalNum(name); sig != 0 {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("signal %s does not exist", name)
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ulfox/cinit/cinitd/models"
+)
+
+var (
+	// PasswdFile is the passwd database used for resolving user names
+	PasswdFile = "/etc/passwd"
+	// GroupFile is the group database used for resolving group names
+	GroupFile = "/etc/group"
+)
+
+// ResolveCredential resolves user, group and supplementary group names (or numeric ids)
+// using PasswdFile and GroupFile. If group is empty, the primary group of the user is used.
+// If user is empty, the uid of the current process is kept
+func ResolveCredential(user, group string, supplementaryGroups []string) (*models.Credential, error) {
+	cred := &models.Credential{
+		UID:    uint32(os.Getuid()),
+		GID:    uint32(os.Getgid()),
+		Groups: make([]uint32, 0, len(supplementaryGroups)),
+	}
+
+	if user != "" {
+		uid, gid, err := LookupUser(user)
+		if err != nil {
+			return nil, err
+		}
+		cred.UID = uid
+		cred.GID = gid
+	}
+
+	if group != "" {
+		gid, err := LookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		cred.GID = gid
+	}
+
+	for _, g := range supplementaryGroups {
+		gid, err := LookupGroup(g)
+		if err != nil {
+			return nil, err
+		}
+		cred.Groups = append(cred.Groups, gid)
+	}
+
+	return cred, nil
+}
+
+// LookupUser returns the uid and primary gid of a user. Numeric users that are not
+// present in PasswdFile are accepted as is and get a gid equal to their uid
+func LookupUser(user string) (uint32, uint32, error) {
+	var uid, gid uint32
+	var found bool
+	err := readColonFile(PasswdFile, func(fields []string) bool {
+		if len(fields) < 4 || (fields[0] != user && fields[2] != user) {
+			return false
+		}
+		u, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return false
+		}
+		g, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return false
+		}
+		uid, gid, found = uint32(u), uint32(g), true
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+
+	if !found {
+		id, err := strconv.ParseUint(user, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("user %s does not exist in %s", user, PasswdFile)
+		}
+		return uint32(id), uint32(id), nil
+	}
+
+	return uid, gid, nil
+}
+
+// LookupGroup returns the gid of a group. Numeric groups that are not present in
+// GroupFile are accepted as is
+func LookupGroup(group string) (uint32, error) {
+	var gid uint32
+	var found bool
+	err := readColonFile(GroupFile, func(fields []string) bool {
+		if len(fields) < 3 || (fields[0] != group && fields[2] != group) {
+			return false
+		}
+		g, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return false
+		}
+		gid, found = uint32(g), true
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	if !found {
+		id, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("group %s does not exist in %s", group, GroupFile)
+		}
+		return uint32(id), nil
+	}
+
+	return gid, nil
+}
+
+// readColonFile calls match for every entry of a colon separated database until
+// match returns true
+func readColonFile(path string, match func([]string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if match(strings.Split(line, ":")) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"flag"
-	"fmt"
+	"net"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/ulfox/cinit/cinitd/utils"
@@ -11,12 +12,15 @@ import (
 
 var (
 	logger *logrus.Logger
-	host   string
+	target string
 )
 
 func main() {
-	cinitdPort := flag.String("cinitd-port", "8081", "listening port of cinitd")
-	cinitdHost := flag.String("cinitd-host", "localhost", "cinitd host")
+	unixSocket := flag.String("unix-socket", "/tmp/cinit.sock", "unix socket of cinitd")
+	grpcAddr := flag.String("grpc-addr", "", "TCP address (host:port) of the gRPC API of cinitd, used instead of -unix-socket")
+	cinitdHost := flag.String("cinitd-host", "", "deprecated: host of -grpc-addr")
+	cinitdPort := flag.String("cinitd-port", "", "deprecated: port of -grpc-addr, the port of the gRPC API and not of the HTTP API")
+	token := flag.String("token", "", "API token of cinitd (default $CINIT_TOKEN)")
 	cinitService := flag.String("f", "", "service file")
 	serviceRegister := flag.Bool("register", false, "create a new service")
 	serviceDelete := flag.Bool("delete", false, "delete a service, this will also stop the service")
@@ -24,19 +28,41 @@ func main() {
 	serviceStatus := flag.Bool("status", false, "get the status of a registed service")
 	serviceName := flag.String("name", "", "service name")
 	serviceStart := flag.Bool("start", false, "start a service")
+	serviceRestart := flag.Bool("restart", false, "restart a service")
 	serviceList := flag.Bool("list", false, "list services")
+	serviceReload := flag.Bool("reload", false, "reload a service with its reload signal or reload command")
+	serviceSignal := flag.String("signal", "", "send a signal (name or number) to a service")
+	signalGroup := flag.Bool("signal-group", false, "send the signal of -signal to the process group of the service")
+	serviceScale := flag.Int("scale", 0, "set the number of replicas of a service")
 
 	flag.Parse()
 
 	logger = logrus.New()
 
-	if *cinitdHost == "" || *cinitdPort == "" {
-		logger.Fatalf("cinitd host/port can not be empty")
+	// -cinitd-host and -cinitd-port used to select the HTTP API, they are kept for
+	// existing scripts and now select the TCP address of the gRPC API
+	if *grpcAddr == "" && (*cinitdHost != "" || *cinitdPort != "") {
+		logger.Warn("-cinitd-host and -cinitd-port are deprecated, use -grpc-addr")
+		h, p := *cinitdHost, *cinitdPort
+		if h == "" {
+			h = "localhost"
+		}
+		if p == "" {
+			logger.Fatalf("-cinitd-port must be set to the gRPC port of cinitd")
+		}
+		*grpcAddr = net.JoinHostPort(h, p)
 	}
 
-	host = *cinitdHost
-	if *cinitdPort != "80" {
-		host = fmt.Sprintf("%s:%s", *cinitdHost, *cinitdPort)
+	target = *grpcAddr
+	if target == "" {
+		if *unixSocket == "" {
+			logger.Fatalf("cinitd unix socket can not be empty")
+		}
+		target = "unix://" + *unixSocket
+	}
+
+	if *token == "" {
+		*token = os.Getenv("CINIT_TOKEN")
 	}
 
 	env := utils.GetCInitEnv()
@@ -44,7 +70,25 @@ func main() {
 		logger.SetLevel(logrus.DebugLevel)
 	}
 
-	c := commands.NewCommandFactory(host, logger)
+	c, err := commands.NewCommandFactory(target, *token, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer c.Close()
+
+	if flag.Arg(0) == "logs" {
+		if err := logsCommand(c, flag.Args()[1:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "events" {
+		if err := eventsCommand(c, flag.Args()[1:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
 
 	if *serviceRegister {
 		if *cinitService == "" {
@@ -79,9 +123,28 @@ func main() {
 		if err != nil {
 			logger.Fatal(err)
 		}
+	} else if *serviceRestart {
+		err := c.Action(serviceName, "restart")
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else if *serviceReload {
+		err := c.Action(serviceName, "reload")
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else if *serviceSignal != "" {
+		err := c.Signal(serviceName, *serviceSignal, *signalGroup)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else if *serviceScale != 0 {
+		err := c.Scale(serviceName, *serviceScale)
+		if err != nil {
+			logger.Fatal(err)
+		}
 	} else if *serviceList {
-		sn := "all"
-		err := c.Action(&sn, "list")
+		err := c.List()
 		if err != nil {
 			logger.Fatal(err)
 		}
@@ -1,9 +1,14 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
-	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func (c *Command) Action(name *string, T string) error {
@@ -15,26 +20,142 @@ func (c *Command) Action(name *string, T string) error {
 		return c.wrapErr("Service name can not be empty")
 	}
 
-	service := models.Service{
-		T:    T,
-		Name: *name,
+	ctx, cancel := c.callContext()
+	defer cancel()
+
+	req := &pb.ServiceRequest{Name: *name}
+	var (
+		reply *pb.ServiceStatus
+		err   error
+	)
+	switch T {
+	case "status":
+		reply, err = c.client.Status(ctx, req)
+	case "start":
+		reply, err = c.client.Start(ctx, req)
+	case "stop":
+		reply, err = c.client.Stop(ctx, req)
+	case "restart":
+		reply, err = c.client.Restart(ctx, req)
+	case "reload":
+		reply, err = c.client.Reload(ctx, req)
+	case "delete":
+		reply, err = c.client.Delete(ctx, req)
+	default:
+		return c.wrapErr("service action %s not supported", T)
+	}
+	if err != nil {
+		return c.wrapErr(err)
+	}
+
+	return c.printReply(reply)
+}
+
+// List prints the names of the registered services
+func (c *Command) List() error {
+	ctx, cancel := c.callContext()
+	defer cancel()
+
+	reply, err := c.client.List(ctx, &pb.ListRequest{})
+	if err != nil {
+		return c.wrapErr(err)
+	}
+	if len(reply.Services) == 0 {
+		fmt.Println("No services")
+		return nil
+	}
+
+	return c.printReply(reply)
+}
+
+// Signal sends a signal to the process of a service, or to its process group
+func (c *Command) Signal(name *string, signal string, group bool) error {
+	if name == nil || len(*name) < 1 {
+		return c.wrapErr("Service name can not be empty")
+	}
+
+	ctx, cancel := c.callContext()
+	defer cancel()
+
+	reply, err := c.client.Signal(ctx, &pb.SignalRequest{
+		Name:   *name,
+		Signal: signal,
+		Group:  group,
+	})
+	if err != nil {
+		return c.wrapErr(err)
+	}
+
+	return c.printReply(reply)
+}
+
+// Scale sets the number of replicas of a service
+func (c *Command) Scale(name *string, replicas int) error {
+	if name == nil || len(*name) < 1 {
+		return c.wrapErr("Service name can not be empty")
 	}
 
-	data, err := c.pushToServer(service)
+	ctx, cancel := c.callContext()
+	defer cancel()
+
+	reply, err := c.client.Scale(ctx, &pb.ScaleRequest{
+		Name:     *name,
+		Replicas: int32(replicas),
+	})
 	if err != nil {
 		return c.wrapErr(err)
 	}
 
-	fmt.Println(string(data))
+	return c.printReply(reply)
+}
 
-	// var prettyJSON bytes.Buffer
-	// err = json.Indent(&prettyJSON, data, "", "\t")
-	// if err != nil {
-	// 	fmt.Print(string(data))
-	// 	return nil
-	// }
+// Logs writes the output of a service to stdout. since is an RFC 3339 time or a duration.
+// With follow set new output is written until cinitd ends the stream
+func (c *Command) Logs(name string, follow bool, tail int, since string, stderr bool) error {
+	if len(name) < 1 {
+		return c.wrapErr("Service name can not be empty")
+	}
 
-	// c.logger.Info("\n", prettyJSON.String())
+	req := &pb.LogsRequest{
+		Name:   name,
+		Stderr: stderr,
+		Tail:   int32(tail),
+		Follow: follow,
+	}
+	if since != "" {
+		t, err := parseSince(since, time.Now())
+		if err != nil {
+			return c.wrapErr(err)
+		}
+		req.Since = timestamppb.New(t)
+	}
+
+	stream, err := c.client.Logs(context.Background(), req)
+	if err != nil {
+		return c.wrapErr(err)
+	}
+	for {
+		line, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return c.wrapErr(err)
+		}
+		if _, err := os.Stdout.Write(line.Line); err != nil {
+			return c.wrapErr(err)
+		}
+	}
+}
 
-	return nil
+// parseSince parses an RFC 3339 time, or a duration that is subtracted from now
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("since must be an RFC 3339 time or a duration")
+	}
+	return t, nil
 }
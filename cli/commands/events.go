@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ulfox/cinit/cinitd/events"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Events prints the events of the services as JSON lines until cinitd ends the stream.
+// name limits the events to a service, after and boot resume from a sequence number of
+// a run of cinitd. Streams that fell behind are resumed from the last printed event
+func (c *Command) Events(name string, after uint64, boot string) error {
+	for {
+		stream, err := c.client.Events(context.Background(), &pb.EventsRequest{
+			Name:  name,
+			After: after,
+			Boot:  boot,
+		})
+		if err != nil {
+			return c.wrapErr(err)
+		}
+
+		for {
+			m, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if status.Code(err) == codes.ResourceExhausted {
+				break
+			}
+			if err != nil {
+				return c.wrapErr(err)
+			}
+
+			data, err := json.Marshal(serviceEvent(m))
+			if err != nil {
+				return c.wrapErr(err)
+			}
+			fmt.Println(string(data))
+			after, boot = m.Seq, m.Boot
+		}
+	}
+}
+
+// serviceEvent converts an event of the gRPC API to the JSON form of the HTTP API
+func serviceEvent(m *pb.Event) events.Event {
+	e := events.Event{
+		Seq:        m.Seq,
+		Boot:       m.Boot,
+		Time:       m.Time.AsTime(),
+		Type:       m.Type,
+		Name:       m.Name,
+		Instance:   m.Instance,
+		PUID:       m.Puid,
+		PID:        int(m.Pid),
+		ExitStatus: m.ExitStatus,
+		Health:     m.Health,
+		Reason:     m.Reason,
+	}
+	if m.ExitCode != nil {
+		code := int(*m.ExitCode)
+		e.ExitCode = &code
+	}
+	return e
+}
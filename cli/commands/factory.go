@@ -1,86 +1,92 @@
 package commands
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/ulfox/cinit/cinitd/definitions"
 	e "github.com/ulfox/cinit/cinitd/errors"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
 	"github.com/ulfox/cinit/cinitd/models"
-	h "github.com/ulfox/cinit/cli/http"
-	"gopkg.in/yaml.v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
+// callTimeout limits the calls to cinitd, except log streams
+const callTimeout = 65 * time.Second
+
 type erf = func(e interface{}, p ...interface{}) error
 
-type Service struct {
-	Name    string `yaml:"name"`
-	Command string `yaml:"command"`
-	Args    string `yaml:"args,omitempty"`
+type Command struct {
+	logger   *logrus.Logger
+	conn     *grpc.ClientConn
+	client   pb.CinitClient
+	wrapErr  erf
+	services []models.Service
 }
 
-type Command struct {
-	logger  *logrus.Logger
-	host    string
-	wrapErr erf
-	service Service
+// bearerToken sends an API token with every call
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
 }
 
-func NewCommandFactory(host string, l *logrus.Logger) *Command {
-	return &Command{
-		logger:  l,
-		host:    host,
-		wrapErr: e.WrapErr,
-	}
+// RequireTransportSecurity is false, since cinitd serves the API without TLS
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
 }
 
-func (c *Command) pushToServer(service models.Service) ([]byte, error) {
-	dataBytes, err := json.Marshal(service)
-	if err != nil {
-		return nil, c.wrapErr(err)
+// NewCommandFactory connects to the gRPC API of cinitd. target is a unix:// socket or a
+// host:port address. token, if not empty, is sent with every call
+func NewCommandFactory(target, token string, l *logrus.Logger) (*Command, error) {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(token)))
 	}
 
-	client, err := h.NewClientFactory(fmt.Sprintf("http://%s/api/services", c.host), c.logger)
+	conn, err := grpc.Dial(target, opts...)
 	if err != nil {
-		return nil, c.wrapErr(err)
+		return nil, e.WrapErr(err)
 	}
 
-	data, err := client.SendByteBatch(dataBytes)
-	if err != nil {
-		return nil, c.wrapErr(err)
-	}
+	return &Command{
+		logger:  l,
+		conn:    conn,
+		client:  pb.NewCinitClient(conn),
+		wrapErr: e.WrapErr,
+	}, nil
+}
 
-	return data, nil
+// Close closes the connection to cinitd
+func (c *Command) Close() error {
+	return c.conn.Close()
 }
 
-func (c *Command) ReadService(file string) error {
-	f, err := os.Open(file)
+func (c *Command) callContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), callTimeout)
+}
+
+// printReply prints a reply of cinitd as JSON
+func (c *Command) printReply(m proto.Message) error {
+	data, err := protojson.Marshal(m)
 	if err != nil {
 		return c.wrapErr(err)
 	}
+	fmt.Println(string(data))
+	return nil
+}
 
-	data := make([]byte, 0)
-	block := make([]byte, 512)
-	for {
-		b, err := f.Read(block)
-		if err != nil {
-			if err != io.EOF {
-				return c.wrapErr(err)
-			}
-			break
-		}
-
-		data = append(data, block[:b]...)
-	}
-	f.Close()
-
-	c.service = Service{}
-	err = yaml.Unmarshal(data, &(c.service))
+func (c *Command) ReadService(file string) error {
+	services, err := definitions.ReadFile(file)
 	if err != nil {
 		return c.wrapErr(err)
 	}
+	c.services = services
 
 	return nil
 }
@@ -2,36 +2,25 @@ package commands
 
 import (
 	"fmt"
-	"regexp"
 
-	"github.com/ulfox/cinit/cinitd/models"
+	"github.com/ulfox/cinit/cinitd/listeners/grpc/pb"
 )
 
 func (c *Command) RegisterService() error {
-	if c.service.Name == "" {
+	if len(c.services) == 0 {
 		return c.wrapErr("Service needs to be set")
 	}
 
-	if c.service.Command == "" {
-		return c.wrapErr("Command needs to be set")
-	}
-
-	service := models.Service{
-		T:       "register",
-		Name:    c.service.Name,
-		Command: c.service.Command,
-	}
+	for _, service := range c.services {
+		ctx, cancel := c.callContext()
+		reply, err := c.client.Register(ctx, &pb.RegisterRequest{Service: pb.FromModel(service)})
+		cancel()
+		if err != nil {
+			return c.wrapErr(err)
+		}
 
-	if len(c.service.Args) > 0 {
-		service.Args = regexp.MustCompile(`[^\s"]+|"([^"]*)"`).FindAllString(c.service.Args, -1)
+		fmt.Println(reply.Message)
 	}
 
-	data, err := c.pushToServer(service)
-	if err != nil {
-		return c.wrapErr(err)
-	}
-
-	fmt.Println(string(data))
-
 	return nil
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/ulfox/cinit/cli/commands"
+)
+
+// eventsCommand runs cinit events [-name x] [-after N [-boot ID]]
+func eventsCommand(c *commands.Command, args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	name := fs.String("name", "", "only show the events of this service")
+	after := fs.Uint64("after", 0, "resume after this sequence number")
+	boot := fs.String("boot", "", "boot ID of the event of -after, all kept events are shown if cinitd restarted since")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return c.Events(*name, *after, *boot)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/ulfox/cinit/cli/commands"
+)
+
+// logsCommand runs cinit logs -name x [-f] [-tail N] [-since T] [-stderr]
+func logsCommand(c *commands.Command, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	name := fs.String("name", "", "service name")
+	follow := fs.Bool("f", false, "follow the output of the service")
+	tail := fs.Int("tail", 0, "number of lines to show from the end of the logs, 0 shows all")
+	since := fs.String("since", "", "show output written since an RFC 3339 time or a duration (10m)")
+	stderr := fs.Bool("stderr", false, "show stderr instead of stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return c.Logs(*name, *follow, *tail, *since, *stderr)
+}